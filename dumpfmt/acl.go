@@ -0,0 +1,131 @@
+// acl.go - decoding of AOS/VS Access Control Lists
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// AOS/VS access privilege bits as held in the byte following each user name in an ACL
+const (
+	AccessOwner   = 0x10
+	AccessWrite   = 0x08
+	AccessAppend  = 0x04
+	AccessRead    = 0x02
+	AccessExecute = 0x01
+)
+
+// ACLEntry is one user name template and the access granted to matching users
+type ACLEntry struct {
+	UserPattern string
+	Access      byte
+}
+
+// Entries decodes the ACL record into its entries.
+//
+// The ACL is a series of null-terminated user names (which may be templates such as "+")
+// each followed by a single access byte, the list itself is terminated by a null.
+func (acl *ACL) Entries() []ACLEntry {
+	return DecodeACL(acl.ACL)
+}
+
+// DecodeACL decodes a raw ACL, a trailing incomplete entry is ignored
+func DecodeACL(raw []byte) (entries []ACLEntry) {
+	for len(raw) > 0 && raw[0] != 0 {
+		nul := bytes.IndexByte(raw, 0)
+		if nul < 0 || nul+1 >= len(raw) {
+			break
+		}
+		entries = append(entries, ACLEntry{UserPattern: string(raw[:nul]), Access: raw[nul+1]})
+		raw = raw[nul+2:]
+	}
+	return entries
+}
+
+// AccessString returns the access privileges in the usual AOS/VS OWARE notation, eg. "RE"
+func (e ACLEntry) AccessString() string {
+	var sb strings.Builder
+	for _, priv := range []struct {
+		bit  byte
+		name byte
+	}{{AccessOwner, 'O'}, {AccessWrite, 'W'}, {AccessAppend, 'A'}, {AccessRead, 'R'}, {AccessExecute, 'E'}} {
+		if e.Access&priv.bit != 0 {
+			sb.WriteByte(priv.name)
+		}
+	}
+	return sb.String()
+}
+
+func (e ACLEntry) String() string {
+	return e.UserPattern + "," + e.AccessString()
+}
+
+// FormatACL returns the ACL as the CLI ACL command would display it, eg. "SMERRONY,OWARE +,RE"
+func FormatACL(entries []ACLEntry) string {
+	strs := make([]string, len(entries))
+	for i, e := range entries {
+		strs[i] = e.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+// EncodeACL is the inverse of DecodeACL
+func EncodeACL(entries []ACLEntry) []byte {
+	var raw []byte
+	for _, e := range entries {
+		raw = append(raw, e.UserPattern...)
+		raw = append(raw, 0, e.Access)
+	}
+	return append(raw, 0)
+}
+
+// ParseACL parses an ACL in the notation produced by FormatACL, eg. "SMERRONY,OWARE +,RE"
+func ParseACL(s string) ([]ACLEntry, error) {
+	var entries []ACLEntry
+	for _, field := range strings.Fields(s) {
+		parts := strings.Split(field, ",")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid ACL entry <%s>", field)
+		}
+		e := ACLEntry{UserPattern: strings.ToUpper(parts[0])}
+		for _, priv := range strings.ToUpper(parts[1]) {
+			switch priv {
+			case 'O':
+				e.Access |= AccessOwner
+			case 'W':
+				e.Access |= AccessWrite
+			case 'A':
+				e.Access |= AccessAppend
+			case 'R':
+				e.Access |= AccessRead
+			case 'E':
+				e.Access |= AccessExecute
+			default:
+				return nil, fmt.Errorf("invalid access <%c> in ACL entry <%s>", priv, field)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,195 @@
+// aosvsDumpFmt.go - AOS/VS Dump Format structures
+
+// Based on info from AOS/VS Systems Internals Reference Manual (AOS/VS Rev. 5.00)
+// This file is part of the dumpfmt package used by loadg.
+
+// Copyright 2018 Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package dumpfmt reads the record stream of AOS/VS DUMP_II and DUMP_III files.
+package dumpfmt
+
+type (
+	// WordT - a DG Word is 16-bit unsigned
+	WordT uint16
+	// DwordT - a DG Double-Word is 32-bit unsigned
+	DwordT uint32
+	// ByteT - a DG Byte is 8-bit unsigned
+	ByteT byte
+)
+
+// Record types as found in the 6-bit type field of each record header
+const (
+	StartDumpType  = 0
+	FSBType        = 1
+	NameBlockType  = 2
+	UDAType        = 3
+	ACLType        = 4
+	LinkType       = 5
+	StartBlockType = 6
+	DataBlockType  = 7
+	EndBlockType   = 8
+	EndDumpType    = 9
+)
+
+const (
+	// MaxBlockSize is the largest data block DUMP_II/III will write
+	MaxBlockSize = 32768
+	// UDABytes is the length of the User Data Areas in the dumps seen so far
+	UDABytes = 256
+	// MaxNameLength is the longest AOS/VS file name
+	MaxNameLength = 31
+	// MaxNameBlockBytes is the longest name block Resync will accept, a name padded with NULs
+	MaxNameBlockBytes = 64
+
+	maxAlignmentOffset = 256
+	diskBlockBytes     = 512
+)
+
+// RecordHeader is common to every record in a dump.
+// Offset is the position of the header in the dump stream.
+type RecordHeader struct {
+	RecordType   int
+	RecordLength int
+	Offset       int64
+}
+
+// Header returns the header of the record
+func (h RecordHeader) Header() RecordHeader { return h }
+
+// Record is implemented by every record type returned by Reader.Next()
+type Record interface {
+	Header() RecordHeader
+}
+
+// SOD - Start Of Dump
+type SOD struct {
+	RecordHeader
+	DumpFormatRevision                        WordT
+	DumpTimeSecs, DumpTimeMins, DumpTimeHours WordT
+	DumpTimeDay, DumpTimeMonth, DumpTimeYear  WordT
+}
+
+// FSB - the FSTAT packet of the following entry, both raw and decoded
+type FSB struct {
+	RecordHeader
+	Blob  []byte
+	Fstat Fstat
+}
+
+// EntryType returns the FSTAT entry type byte of the FSB
+func (f *FSB) EntryType() byte {
+	if f == nil || len(f.Blob) < 2 {
+		return 0
+	}
+	return f.Blob[1]
+}
+
+// NameBlock holds the (unqualified) name of the current entry
+type NameBlock struct {
+	RecordHeader
+	FileName string
+}
+
+// UDA - User Data Area Block
+type UDA struct {
+	RecordHeader
+	UDA []byte
+}
+
+// ACL - Access Control List block
+type ACL struct {
+	RecordHeader
+	ACL []byte
+}
+
+// Link block, the resolution name uses the AOS/VS ':' separator
+type Link struct {
+	RecordHeader
+	LinkResolutionName string
+}
+
+// StartBlock - precedes the data blocks of a file
+type StartBlock struct {
+	RecordHeader
+}
+
+// DataBlock - a Data Header Block and the data that follows it
+type DataBlock struct {
+	RecordHeader
+	ByteAddress    DwordT
+	ByteLength     DwordT
+	AlignmentCount WordT
+	Data           []byte
+}
+
+// EndBlock - ends either a file or a directory
+type EndBlock struct {
+	RecordHeader
+}
+
+// EndOfDump - the last record in a dump
+type EndOfDump struct {
+	RecordHeader
+}
+
+// FstatEntry holds the interesting info for each FSTAT type
+type FstatEntry struct {
+	DgMnemonic string
+	Desc       string
+	IsDir      bool
+	HasPayload bool
+}
+
+// FSTAT entry types which are treated specially
+const (
+	FlnkType = 0
+	FdirType = 10
+	FtxtType = 68
+	FprvType = 74
+	FprgType = 87
+)
+
+// KnownFstatEntryTypes is a map of FSTAT IDs to FSTAT entries
+var KnownFstatEntryTypes = map[byte]FstatEntry{
+	FlnkType: {DgMnemonic: "FLNK", Desc: "=>Link=>", IsDir: false, HasPayload: false},
+	1:        {DgMnemonic: "FDSF", Desc: "System Data File", IsDir: false, HasPayload: true},
+	2:        {DgMnemonic: "FMTF", Desc: "Mag Tape File", IsDir: false, HasPayload: true},
+	3:        {DgMnemonic: "FGFN", Desc: "Generic File", IsDir: false, HasPayload: true},
+	FdirType: {DgMnemonic: "FDIR", Desc: "<Directory>", IsDir: true, HasPayload: false},
+	11:       {DgMnemonic: "FLDU", Desc: "<LDU Directory>", IsDir: true, HasPayload: false},
+	12:       {DgMnemonic: "FCPD", Desc: "<Control Point Dir>", IsDir: true, HasPayload: false},
+	64:       {DgMnemonic: "FUDF", Desc: "User Data File", IsDir: false, HasPayload: true},
+	66:       {DgMnemonic: "FUPD", Desc: "User Profile", IsDir: false, HasPayload: true},
+	67:       {DgMnemonic: "FSTF", Desc: "Symbol Table", IsDir: false, HasPayload: true},
+	FtxtType: {DgMnemonic: "FTXT", Desc: "Text File", IsDir: false, HasPayload: true},
+	69:       {DgMnemonic: "FLOG", Desc: "System Log File", IsDir: false, HasPayload: true},
+	FprvType: {DgMnemonic: "FPRV", Desc: "Program File", IsDir: false, HasPayload: true},
+	FprgType: {DgMnemonic: "FPRG", Desc: "Program File", IsDir: false, HasPayload: true},
+}
+
+// FstatTypeByMnemonic returns the FSTAT entry type with the given DG mnemonic, eg. "FTXT"
+func FstatTypeByMnemonic(mnemonic string) (entryType byte, found bool) {
+	for et, fe := range KnownFstatEntryTypes {
+		if fe.DgMnemonic == mnemonic {
+			return et, true
+		}
+	}
+	return 0, false
+}
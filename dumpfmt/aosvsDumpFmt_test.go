@@ -0,0 +1,50 @@
+package dumpfmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetKnownEntryTypes(t *testing.T) {
+	fmtf := KnownFstatEntryTypes[2]
+	if "FMTF" != fmtf.DgMnemonic {
+		t.Errorf("Expected 'FMTF', got '%s'", fmtf.DgMnemonic)
+	}
+}
+
+func TestDecodeFstat(t *testing.T) {
+	pkt := make([]byte, 44)
+	pkt[0], pkt[1] = RecFmtDataSensitive, 68
+	pkt[12], pkt[13], pkt[14], pkt[15] = 0, 1, 0, 30 // modified 1st Jan 1968 00:01:00
+	pkt[24], pkt[25], pkt[26], pkt[27] = 0, 1, 0x86, 0xa0
+	fs := DecodeFstat(pkt)
+	if fs.EntryType != 68 || fs.RecordFormatName() != "Data Sensitive" {
+		t.Errorf("Expected FTXT/Data Sensitive, got %d/%s", fs.EntryType, fs.RecordFormatName())
+	}
+	if want := time.Date(1968, time.January, 1, 0, 1, 0, 0, time.UTC); !fs.Modified.Equal(want) {
+		t.Errorf("Expected modification time %v, got %v", want, fs.Modified)
+	}
+	if !fs.Accessed.IsZero() {
+		t.Errorf("Expected zero access time, got %v", fs.Accessed)
+	}
+	if fs.FileLength != 100000 {
+		t.Errorf("Expected length 100000, got %d", fs.FileLength)
+	}
+	if short := DecodeFstat(pkt[:2]); short.FileLength != 0 || short.EntryType != 68 {
+		t.Errorf("Short packet not decoded correctly: %+v", short)
+	}
+}
+
+func TestDecodeACL(t *testing.T) {
+	raw := []byte("SMERRONY\x00\x1f+\x00\x03\x00")
+	entries := DecodeACL(raw)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 ACL entries, got %d", len(entries))
+	}
+	if got := FormatACL(entries); got != "SMERRONY,OWARE +,RE" {
+		t.Errorf("Expected 'SMERRONY,OWARE +,RE', got '%s'", got)
+	}
+	if truncated := DecodeACL(raw[:10]); len(truncated) != 1 {
+		t.Errorf("Expected 1 entry from truncated ACL, got %d", len(truncated))
+	}
+}
@@ -0,0 +1,67 @@
+// errors.go - errors returned by the dumpfmt package
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of problem that may be found in a dump, use errors.Is() to test for them
+var (
+	ErrTruncated         = errors.New("truncated record")
+	ErrUnknownRecordType = errors.New("unknown record type")
+	ErrBlockTooLarge     = errors.New("maximum block size exceeded")
+	ErrMissingSOD        = errors.New("no START record - this does not appear to be an AOS/VS DUMP_II or DUMP_III file")
+	ErrDuplicateSOD      = errors.New("another START record found in dump")
+	ErrVolumeSequence    = errors.New("volumes out of sequence or from different dumps")
+)
+
+// NoRecordType is used in a FormatError when the record type could not be read
+const NoRecordType = -1
+
+// FormatError is returned by Reader.Next() when the dump cannot be parsed.
+// Offset is the position of the header of the offending record.
+type FormatError struct {
+	Err        error
+	Offset     int64
+	RecordType int
+	Detail     string
+}
+
+func (e *FormatError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+	if e.RecordType != NoRecordType {
+		msg += fmt.Sprintf(" (record type %d)", e.RecordType)
+	}
+	if e.Detail != "" {
+		msg += " - " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap returns the kind of error, eg. ErrTruncated
+func (e *FormatError) Unwrap() error { return e.Err }
+
+func newFormatError(err error, hdr RecordHeader, format string, a ...interface{}) *FormatError {
+	return &FormatError{Err: err, Offset: hdr.Offset, RecordType: hdr.RecordType, Detail: fmt.Sprintf(format, a...)}
+}
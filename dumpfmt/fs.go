@@ -0,0 +1,258 @@
+// fs.go - an io/fs.FS view of an indexed AOS/VS dump
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errLinkOutside is returned for links whose targets lead above the top of the dump
+var errLinkOutside = errors.New("link leads outside the dump")
+
+// maxLinkHops limits the number of links followed when resolving a path
+const maxLinkHops = 16
+
+// FS is a read-only io/fs.FS of the contents of an indexed dump.
+// Paths are as in the Index, eg. "UDD/FRED/PROG.SR".  Links are followed by Open and Stat
+// when their targets are within the dump, use Lstat and ReadLink to examine the links themselves.
+// The Sys() method of the FileInfo returned by Stat and Lstat returns the *IndexEntry.
+type FS struct {
+	ix   *Index
+	dump io.ReaderAt
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// NewFS returns an FS reading file contents from dump, which must be the file that was indexed
+func NewFS(ix *Index, dump io.ReaderAt) *FS {
+	return &FS{ix: ix, dump: dump}
+}
+
+// Open opens the named file or directory
+func (fsys *FS) Open(name string) (fs.File, error) {
+	e, err := fsys.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return &fsDir{entry: e, info: entryInfo{e, name}}, nil
+	}
+	return &fsFile{entry: e, info: entryInfo{e, name}, dump: fsys.dump}, nil
+}
+
+// Stat returns a FileInfo describing the named file or directory, following links
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := fsys.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return entryInfo{e, name}, nil
+}
+
+// Lstat returns a FileInfo describing the named file, directory or link, without following links
+func (fsys *FS) Lstat(name string) (fs.FileInfo, error) {
+	e, err := fsys.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return entryInfo{e, name}, nil
+}
+
+// ReadLink returns the target of the named link as a path from the top of the dump, which is
+// the path Open and Stat follow the link to
+func (fsys *FS) ReadLink(name string) (string, error) {
+	e, err := fsys.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !e.IsLink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, ok := e.resolvedLink()
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errLinkOutside}
+	}
+	return target, nil
+}
+
+// ReadDir returns the contents of the named directory sorted by name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	des := dirEntries(e.Children)
+	sort.Slice(des, func(i, j int) bool { return des[i].Name() < des[j].Name() })
+	return des, nil
+}
+
+// resolve finds the entry for name, following links in the directories of name
+// and, if follow is set, the final element
+func (fsys *FS) resolve(op, name string, follow bool) (*IndexEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e := fsys.ix.Root
+	if name == "." {
+		return e, nil
+	}
+	hops := 0
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		next, found := fsys.ix.Lookup(path.Join(e.Path, elem))
+		if !found {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		for next.IsLink() && (follow || i < len(elems)-1) {
+			if hops++; hops > maxLinkHops {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many links")}
+			}
+			target, ok := next.resolvedLink()
+			if !ok {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errLinkOutside}
+			}
+			if next, found = fsys.ix.Lookup(target); !found {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+		}
+		e = next
+	}
+	return e, nil
+}
+
+// resolvedLink returns the Index path of the link target, an absolute target is taken to be relative to the top of the dump
+func (e *IndexEntry) resolvedLink() (string, bool) {
+	return ResolveLink(path.Dir(e.Path), e.LinkTarget, IndexName)
+}
+
+// entryInfo implements fs.FileInfo and fs.DirEntry for an IndexEntry
+type entryInfo struct {
+	e    *IndexEntry
+	name string // as opened, which may be a link
+}
+
+func (ei entryInfo) Name() string { return path.Base(ei.name) }
+func (ei entryInfo) Size() int64  { return ei.e.Size }
+func (ei entryInfo) Mode() fs.FileMode {
+	switch {
+	case ei.e.IsDir():
+		return fs.ModeDir | 0555
+	case ei.e.IsLink():
+		return fs.ModeSymlink | 0777
+	case ei.e.Fstat.EntryType == FprgType || ei.e.Fstat.EntryType == FprvType:
+		return 0555
+	default:
+		return 0444
+	}
+}
+func (ei entryInfo) ModTime() time.Time         { return ei.e.Fstat.Modified }
+func (ei entryInfo) IsDir() bool                { return ei.e.IsDir() }
+func (ei entryInfo) Sys() any                   { return ei.e }
+func (ei entryInfo) Type() fs.FileMode          { return ei.Mode().Type() }
+func (ei entryInfo) Info() (fs.FileInfo, error) { return ei, nil }
+
+func dirEntries(entries []*IndexEntry) []fs.DirEntry {
+	des := make([]fs.DirEntry, len(entries))
+	for i, e := range entries {
+		des[i] = entryInfo{e, e.Path}
+	}
+	return des
+}
+
+// fsFile is an open file, which also supports io.ReaderAt and io.Seeker
+type fsFile struct {
+	entry  *IndexEntry
+	info   entryInfo
+	dump   io.ReaderAt
+	offset int64
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsFile) Close() error               { return nil }
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	n, err := f.entry.ReadAt(f.dump, p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.entry.ReadAt(f.dump, p, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.entry.Size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// fsDir is an open directory, its ReadDir returns entries in dump order
+type fsDir struct {
+	entry *IndexEntry
+	info  entryInfo
+	next  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns up to n entries, or all the remaining entries if n <= 0
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entry.Children[d.next:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(remaining) {
+			remaining = remaining[:n]
+		}
+	}
+	d.next += len(remaining)
+	return dirEntries(remaining), nil
+}
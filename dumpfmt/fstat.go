@@ -0,0 +1,194 @@
+// fstat.go - decoding of the FSTAT packet held in each FSB
+
+// Based on the ?FSTAT packet described in the AOS/VS Systems Internals Reference Manual (AOS/VS Rev. 5.00)
+// and the AOS/VS System Call Dictionary.
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"fmt"
+	"time"
+)
+
+// word offsets within the FSTAT packet
+const (
+	fstatSTYP = 0  // record format (LH), entry type (RH)
+	fstatSSTS = 1  // file status/attributes
+	fstatSTCH = 2  // time of creation/last status change (2 words)
+	fstatSTAL = 4  // time of last access (2 words)
+	fstatSTIM = 6  // time of last modification (2 words)
+	fstatSRLN = 8  // record length
+	fstatSDEH = 9  // file element size (disk blocks)
+	fstatSMIL = 10 // maximum index levels
+	fstatSIDX = 11 // current index levels
+	fstatSEFW = 12 // end of file, ie. length in bytes (2 words)
+	fstatSFAH = 14 // file address (2 words)
+	fstatSMSH = 16 // maximum space, control point directories only (2 words)
+	fstatSCSH = 18 // current space, control point directories only (2 words)
+	fstatSHFS = 20 // hash frame size, directories only
+
+	// FstatPacketBytes is the length of the FSTAT packet written by EncodeFstat
+	FstatPacketBytes = 44
+)
+
+// Record formats as held in the left byte of ?STYP
+const (
+	RecFmtDynamic       = 1
+	RecFmtDataSensitive = 2
+	RecFmtFixed         = 3
+	RecFmtVariable      = 4
+	RecFmtUndefined     = 5
+	RecFmtVariableBlock = 6
+)
+
+// RecordFormatNames maps record formats to their descriptions
+var RecordFormatNames = map[byte]string{
+	RecFmtDynamic:       "Dynamic",
+	RecFmtDataSensitive: "Data Sensitive",
+	RecFmtFixed:         "Fixed Length",
+	RecFmtVariable:      "Variable Length",
+	RecFmtUndefined:     "Undefined",
+	RecFmtVariableBlock: "IBM Variable Block",
+}
+
+// aosvsEpoch - AOS/VS dates are a count of days where day 1 is the 1st of January 1968
+var aosvsEpoch = time.Date(1967, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Fstat is the decoded FSTAT packet of a file-system entry.
+//
+// AOS/VS does not record an owner in the FSTAT packet, ownership is expressed via the ACL.
+// Times are the local times of the dumping system, they are returned as if they were UTC
+// and are zero if not set in the packet.
+type Fstat struct {
+	RecordFormat   byte
+	EntryType      byte
+	Status         WordT
+	Created        time.Time // strictly, the time of the last status change
+	Accessed       time.Time
+	Modified       time.Time
+	RecordLength   WordT
+	ElementSize    WordT // in disk blocks
+	MaxIndexLevels WordT
+	IndexLevels    WordT
+	FileLength     DwordT // in bytes
+	FileAddress    DwordT
+	MaxSpace       DwordT // CPDs only
+	CurrentSpace   DwordT // CPDs only
+	HashFrameSize  WordT  // directories only
+}
+
+// DecodeFstat decodes an FSTAT packet, fields beyond the end of a short packet are left zero
+func DecodeFstat(pkt []byte) Fstat {
+	var fs Fstat
+	word := func(w int) WordT {
+		if len(pkt) < w*2+2 {
+			return 0
+		}
+		return WordT(pkt[w*2])<<8 | WordT(pkt[w*2+1])
+	}
+	dword := func(w int) DwordT {
+		return DwordT(word(w))<<16 | DwordT(word(w+1))
+	}
+	if len(pkt) > 1 {
+		fs.RecordFormat = pkt[0]
+		fs.EntryType = pkt[1]
+	}
+	fs.Status = word(fstatSSTS)
+	fs.Created = aosvsTime(word(fstatSTCH), word(fstatSTCH+1))
+	fs.Accessed = aosvsTime(word(fstatSTAL), word(fstatSTAL+1))
+	fs.Modified = aosvsTime(word(fstatSTIM), word(fstatSTIM+1))
+	fs.RecordLength = word(fstatSRLN)
+	fs.ElementSize = word(fstatSDEH)
+	fs.MaxIndexLevels = word(fstatSMIL)
+	fs.IndexLevels = word(fstatSIDX)
+	fs.FileLength = dword(fstatSEFW)
+	fs.FileAddress = dword(fstatSFAH)
+	fs.MaxSpace = dword(fstatSMSH)
+	fs.CurrentSpace = dword(fstatSCSH)
+	fs.HashFrameSize = word(fstatSHFS)
+	return fs
+}
+
+// EncodeFstat builds an FSTAT packet from fs, it is the inverse of DecodeFstat
+func EncodeFstat(fs Fstat) []byte {
+	pkt := make([]byte, FstatPacketBytes)
+	putWord := func(w int, val WordT) {
+		pkt[w*2] = byte(val >> 8)
+		pkt[w*2+1] = byte(val)
+	}
+	putDword := func(w int, val DwordT) {
+		putWord(w, WordT(val>>16))
+		putWord(w+1, WordT(val))
+	}
+	pkt[0] = fs.RecordFormat
+	pkt[1] = fs.EntryType
+	putWord(fstatSSTS, fs.Status)
+	date, biseconds := aosvsDateTime(fs.Created)
+	putWord(fstatSTCH, date)
+	putWord(fstatSTCH+1, biseconds)
+	date, biseconds = aosvsDateTime(fs.Accessed)
+	putWord(fstatSTAL, date)
+	putWord(fstatSTAL+1, biseconds)
+	date, biseconds = aosvsDateTime(fs.Modified)
+	putWord(fstatSTIM, date)
+	putWord(fstatSTIM+1, biseconds)
+	putWord(fstatSRLN, fs.RecordLength)
+	putWord(fstatSDEH, fs.ElementSize)
+	putWord(fstatSMIL, fs.MaxIndexLevels)
+	putWord(fstatSIDX, fs.IndexLevels)
+	putDword(fstatSEFW, fs.FileLength)
+	putDword(fstatSFAH, fs.FileAddress)
+	putDword(fstatSMSH, fs.MaxSpace)
+	putDword(fstatSCSH, fs.CurrentSpace)
+	putWord(fstatSHFS, fs.HashFrameSize)
+	return pkt
+}
+
+// aosvsDateTime is the inverse of aosvsTime, times before 1968 are not representable and are encoded as zero
+func aosvsDateTime(t time.Time) (date, biseconds WordT) {
+	if t.IsZero() || t.Before(aosvsEpoch.AddDate(0, 0, 1)) {
+		return 0, 0
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(midnight.Sub(aosvsEpoch).Hours()) / 24
+	if days > 0xffff {
+		return 0, 0
+	}
+	return WordT(days), WordT(t.Sub(midnight).Seconds() / 2)
+}
+
+// aosvsTime converts an AOS/VS date (days since 31st Dec 1967) and time (seconds since midnight / 2)
+func aosvsTime(date, biseconds WordT) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+	return aosvsEpoch.AddDate(0, 0, int(date)).Add(time.Duration(biseconds) * 2 * time.Second)
+}
+
+// RecordFormatName returns a description of the record format of the entry
+func (fs Fstat) RecordFormatName() string {
+	if name, known := RecordFormatNames[fs.RecordFormat]; known {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%d)", fs.RecordFormat)
+}
@@ -0,0 +1,226 @@
+// index.go - random access to the entries of an AOS/VS dump
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Extent is one data block of a file: Length bytes at file address Address are stored at DumpOffset in the dump.
+// Areas of a file not covered by any extent are NULLs skipped by DUMP_II/III.
+type Extent struct {
+	Address, Length, DumpOffset int64
+}
+
+// IndexEntry describes a file, directory or link found in a dump
+type IndexEntry struct {
+	Path       string // '/'-separated and upper-cased, as loadg would extract it, "." for the top level
+	Name       string `json:",omitempty"` // as in the dump, whose case may differ from Path
+	Fstat      Fstat
+	ACL        []ACLEntry
+	UDA        []byte `json:",omitempty"`
+	LinkTarget string `json:",omitempty"` // the AOS/VS link resolution name, using ':' separators
+	Size       int64
+	Offset     int64         // of the FSB record of the entry
+	Extents    []Extent      `json:",omitempty"`
+	Children   []*IndexEntry `json:",omitempty"` // directory contents in dump order
+}
+
+// Index locates every entry of a dump so that it may be browsed and read without re-reading the dump
+type Index struct {
+	SOD      SOD
+	Root     *IndexEntry
+	DumpSize int64 // the number of bytes in the dump
+	byPath   map[string]*IndexEntry
+}
+
+// indexVersion identifies the format written by Index.Write
+const indexVersion = 1
+
+// indexFile is the saved form of an Index
+type indexFile struct {
+	Version  int
+	DumpSize int64
+	SOD      SOD
+	Root     *IndexEntry
+}
+
+// BuildIndex reads a complete dump and indexes its entries.
+// The data itself is skipped, so this is quicker if r is also an io.Seeker.
+func BuildIndex(r io.Reader) (*Index, error) {
+	rdr := NewReader(r)
+	rdr.SkipData(true)
+	rec, err := rdr.Next()
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{SOD: *rec.(*SOD), Root: &IndexEntry{Path: ".", Fstat: Fstat{EntryType: FdirType}}}
+	ix.byPath = map[string]*IndexEntry{".": ix.Root}
+	dirs := []*IndexEntry{ix.Root} // directories entered, innermost last
+	var entry *IndexEntry
+	var fstat Fstat
+	var fsbOffset int64
+	inFile := false
+	for {
+		rec, err = rdr.Next()
+		if err == io.EOF {
+			ix.DumpSize = rdr.Offset()
+			return ix, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch r := rec.(type) {
+		case *FSB:
+			fstat, fsbOffset = r.Fstat, r.Offset
+		case *NameBlock:
+			parent := dirs[len(dirs)-1]
+			entry = &IndexEntry{Path: path.Join(parent.Path, strings.ToUpper(r.FileName)), Name: r.FileName, Fstat: fstat, Offset: fsbOffset}
+			parent.Children = append(parent.Children, entry)
+			ix.byPath[entry.Path] = entry
+			if entry.IsDir() {
+				dirs = append(dirs, entry)
+			}
+		case *UDA:
+			if entry != nil {
+				entry.UDA = r.UDA
+			}
+		case *ACL:
+			if entry != nil {
+				entry.ACL = r.Entries()
+			}
+		case *Link:
+			if entry != nil {
+				entry.LinkTarget = r.LinkResolutionName
+			}
+		case *StartBlock:
+			inFile = true
+		case *DataBlock:
+			if entry != nil && r.ByteLength > 0 {
+				entry.Extents = append(entry.Extents, Extent{
+					Address:    int64(r.ByteAddress),
+					Length:     int64(r.ByteLength),
+					DumpOffset: rdr.Offset() - int64(r.ByteLength),
+				})
+				if end := int64(r.ByteAddress) + int64(r.ByteLength); end > entry.Size {
+					entry.Size = end
+				}
+			}
+		case *EndBlock:
+			if inFile {
+				inFile = false
+			} else if len(dirs) > 1 { // dumps may contain 'too many' pops
+				dirs = dirs[:len(dirs)-1]
+			}
+		}
+	}
+}
+
+// Write saves the index so that it may be loaded by ReadIndex instead of re-reading the dump
+func (ix *Index) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(indexFile{Version: indexVersion, DumpSize: ix.DumpSize, SOD: ix.SOD, Root: ix.Root})
+}
+
+// ReadIndex loads an index saved by Index.Write
+func ReadIndex(r io.Reader) (*Index, error) {
+	var saved indexFile
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Version != indexVersion || saved.Root == nil {
+		return nil, fmt.Errorf("unsupported index version %d", saved.Version)
+	}
+	ix := &Index{SOD: saved.SOD, Root: saved.Root, DumpSize: saved.DumpSize, byPath: map[string]*IndexEntry{}}
+	var add func(e *IndexEntry)
+	add = func(e *IndexEntry) {
+		ix.byPath[e.Path] = e
+		for _, c := range e.Children {
+			add(c)
+		}
+	}
+	add(ix.Root)
+	return ix, nil
+}
+
+// Lookup returns the entry with the given '/'-separated path, "." being the top level
+func (ix *Index) Lookup(name string) (*IndexEntry, bool) {
+	e, found := ix.byPath[name]
+	return e, found
+}
+
+// IsDir reports whether the entry is a directory
+func (e *IndexEntry) IsDir() bool {
+	et, known := KnownFstatEntryTypes[e.Fstat.EntryType]
+	return known && et.IsDir
+}
+
+// IsLink reports whether the entry is a link
+func (e *IndexEntry) IsLink() bool {
+	return e.Fstat.EntryType == FlnkType
+}
+
+// HostLinkTarget returns the link target as a '/'-separated path relative to the directory containing the
+// link, so that it stays within a mounted or extracted dump.  ok is false if the target leads above the top of the dump.
+func (e *IndexEntry) HostLinkTarget() (target string, ok bool) {
+	if target, ok = e.resolvedLink(); !ok {
+		return "", false
+	}
+	return RelativePath(path.Dir(e.Path), target), true
+}
+
+// ReadAt reads the contents of the entry from dump, the dump file that was indexed.
+// Regions skipped by DUMP_II/III are returned as NULLs.
+func (e *IndexEntry) ReadAt(dump io.ReaderAt, p []byte, off int64) (int, error) {
+	if off >= e.Size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if int64(want) > e.Size-off {
+		want = int(e.Size - off)
+	}
+	for i := range p[:want] {
+		p[i] = 0
+	}
+	for _, ext := range e.Extents {
+		start, end := ext.Address, ext.Address+ext.Length
+		if end <= off || start >= off+int64(want) {
+			continue
+		}
+		if start < off {
+			start = off
+		}
+		if end > off+int64(want) {
+			end = off + int64(want)
+		}
+		if _, err := dump.ReadAt(p[start-off:end-off], ext.DumpOffset+start-ext.Address); err != nil {
+			return 0, err
+		}
+	}
+	if want < len(p) {
+		return want, io.EOF
+	}
+	return want, nil
+}
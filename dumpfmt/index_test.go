@@ -0,0 +1,135 @@
+package dumpfmt
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// indexedDump returns the index of a small dump and the dump itself
+func indexedDump(t *testing.T) (*Index, *bytes.Reader) {
+	var buf bytes.Buffer
+	dw := NewWriter(&buf)
+	acl := []ACLEntry{{UserPattern: "+", Access: AccessRead}}
+	for _, err := range []error{
+		dw.WriteSOD(SOD{DumpFormatRevision: 16}),
+		dw.WriteFSB(Fstat{EntryType: FdirType}),
+		dw.WriteName("udd"),
+		dw.WriteACL(acl),
+		dw.WriteFSB(Fstat{EntryType: 64}),
+		dw.WriteName("sparse"),
+		dw.WriteACL(acl),
+		dw.WriteStartBlock(),
+		dw.WriteDataBlock(0, []byte("HEAD")),
+		dw.WriteDataBlock(10, []byte("TAIL")),
+		dw.WriteEndBlock(),
+		dw.WriteFSB(Fstat{EntryType: FlnkType}),
+		dw.WriteName("lnk"),
+		dw.WriteACL(acl),
+		dw.WriteLink("^:TOP"),
+		dw.WriteEndBlock(),
+		dw.WriteEndBlock(), // too many pops are legal
+		dw.WriteFSB(Fstat{EntryType: 68}),
+		dw.WriteName("TOP"),
+		dw.WriteACL(acl),
+		dw.WriteStartBlock(),
+		dw.WriteDataBlock(0, []byte("TOP\n")),
+		dw.WriteEndBlock(),
+		dw.WriteEndOfDump(),
+	} {
+		if err != nil {
+			t.Fatalf("Unexpected error writing dump: %v", err)
+		}
+	}
+	dump := bytes.NewReader(buf.Bytes())
+	ix, err := BuildIndex(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ix, dump
+}
+
+func TestIndex(t *testing.T) {
+	ix, dump := indexedDump(t)
+	var names []string
+	for _, e := range ix.Root.Children {
+		names = append(names, e.Path)
+	}
+	if len(names) != 2 || names[0] != "UDD" || names[1] != "TOP" {
+		t.Errorf("Expected top level entries [UDD TOP], got %v", names)
+	}
+	lnk, found := ix.Lookup("UDD/LNK")
+	if target, ok := lnk.HostLinkTarget(); !found || !lnk.IsLink() || !ok || target != "../TOP" {
+		t.Errorf("Expected link UDD/LNK to ../TOP, got %+v", lnk)
+	}
+	sparse, found := ix.Lookup("UDD/SPARSE")
+	if !found || sparse.Size != 14 || FormatACL(sparse.ACL) != "+,R" {
+		t.Fatalf("Expected 14-byte UDD/SPARSE, got %+v", sparse)
+	}
+	tests := []struct {
+		off, n int
+		want   string
+		eof    bool
+	}{
+		{0, 14, "HEAD\x00\x00\x00\x00\x00\x00TAIL", false},
+		{2, 4, "AD\x00\x00", false},
+		{11, 10, "AIL", true},
+		{14, 1, "", true},
+	}
+	for _, tt := range tests {
+		p := make([]byte, tt.n)
+		n, err := sparse.ReadAt(dump, p, int64(tt.off))
+		if string(p[:n]) != tt.want || (err == io.EOF) != tt.eof {
+			t.Errorf("ReadAt(%d, %d): expected %q (EOF %v), got %q, %v", tt.n, tt.off, tt.want, tt.eof, p[:n], err)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	fsys := NewFS(indexedDump(t))
+	if err := fstest.TestFS(fsys, "UDD/SPARSE", "UDD/LNK", "TOP"); err != nil {
+		t.Error(err)
+	}
+	content, err := fs.ReadFile(fsys, "UDD/LNK")
+	if err != nil || string(content) != "TOP\n" {
+		t.Errorf("Expected to read TOP via link, got %q, %v", content, err)
+	}
+	info, err := fsys.Stat("UDD/SPARSE")
+	if err != nil || info.Mode() != 0444 || info.Sys().(*IndexEntry).Fstat.EntryType != 64 {
+		t.Errorf("Unexpected Stat of UDD/SPARSE: %v, %v", info, err)
+	}
+	target, err := fsys.ReadLink("UDD/LNK")
+	if err != nil || target != "TOP" {
+		t.Fatalf("Expected UDD/LNK to read as TOP, got %q, %v", target, err)
+	}
+	viaLink, err := fsys.Stat("UDD/LNK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := fsys.Stat(target)
+	if err != nil || viaLink.Sys() != direct.Sys() {
+		t.Errorf("Stat of UDD/LNK and of its target %s disagree: %v, %v, %v", target, viaLink, direct, err)
+	}
+}
+
+func TestHostLinkTarget(t *testing.T) {
+	tests := []struct {
+		path, target, expected string // "" if the target is outside the dump
+	}{
+		{"UDD/LNK", "^:TOP", "../TOP"},
+		{"UDD/LNK", "^TOP", "../TOP"},
+		{"UDD/FRED/LNK", ":UDD:JIM:A.SR", "../JIM/A.SR"},
+		{"LNK", ":UDD:FRED", "UDD/FRED"},
+		{"UDD/LNK", "sub:a", "SUB/A"},
+		{"UDD/LNK", "^^^:ETC:PASSWD", ""},
+		{"UDD/FRED/LNK", ":", "../.."},
+	}
+	for _, tt := range tests {
+		e := &IndexEntry{Path: tt.path, Fstat: Fstat{EntryType: FlnkType}, LinkTarget: tt.target}
+		if got, ok := e.HostLinkTarget(); got != tt.expected || ok != (tt.expected != "") {
+			t.Errorf("%s -> %s: expected %s, got %s (%v)", tt.path, tt.target, tt.expected, got, ok)
+		}
+	}
+}
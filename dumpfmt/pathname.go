@@ -0,0 +1,145 @@
+// pathname.go - AOS/VS pathname prefixes and resolution
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"path"
+	"strings"
+)
+
+// AOS/VS pathname prefixes
+const (
+	PrefixRoot       = ':' // the root directory, also the separator of the names in a pathname
+	PrefixParent     = '^' // the parent of the working directory, may be repeated
+	PrefixWorking    = '=' // the working directory
+	PrefixPeripheral = '@' // the peripheral directory, :PER
+)
+
+// peripheralDir is the directory named by the '@' prefix
+const peripheralDir = "PER"
+
+// SplitPathname splits an AOS/VS pathname such as ":UDD:FRED", "^^SRC:A.SR" or "^:TOP" into its names.
+// Each '^' becomes an element "^", which cannot be a name, '=' is dropped and absolute is set if the pathname
+// starts at the root (':' or '@').
+func SplitPathname(p string) (absolute bool, elems []string) {
+	switch {
+	case strings.HasPrefix(p, string(PrefixRoot)):
+		absolute = true
+	case strings.HasPrefix(p, string(PrefixPeripheral)):
+		absolute = true
+		elems = append(elems, peripheralDir)
+		p = p[1:]
+	}
+	for _, part := range strings.Split(p, string(PrefixRoot)) {
+		for part != "" && (part[0] == PrefixParent || part[0] == PrefixWorking) {
+			if part[0] == PrefixParent {
+				elems = append(elems, string(PrefixParent))
+			}
+			part = part[1:]
+		}
+		if part != "" {
+			elems = append(elems, part)
+		}
+	}
+	return absolute, elems
+}
+
+// FormatPathname is the inverse of SplitPathname, giving eg. "^A.TXT" for ["^" "A.TXT"]
+func FormatPathname(absolute bool, elems []string) string {
+	var names []string
+	ups := 0
+	for _, elem := range elems {
+		switch {
+		case elem == "" || elem == ".":
+		case elem != string(PrefixParent):
+			names = append(names, elem)
+		case len(names) > 0:
+			names = names[:len(names)-1]
+		case !absolute:
+			ups++
+		}
+	}
+	var sb strings.Builder
+	if absolute {
+		sb.WriteByte(PrefixRoot)
+	}
+	sb.WriteString(strings.Repeat(string(PrefixParent), ups))
+	sb.WriteString(strings.Join(names, string(PrefixRoot)))
+	if sb.Len() == 0 {
+		return string(PrefixWorking)
+	}
+	return sb.String()
+}
+
+// ResolveLink returns the '/'-separated path named by the AOS/VS link target used in directory dir, both
+// relative to the same top directory, ie. the top of the dump or of the tree or archive it is extracted to.
+// ':' is the top and each name in the target is given by mapName, called with the resolved directory
+// containing it.  ok is false if the target leads above the top.
+func ResolveLink(dir, target string, mapName func(parent, name string) string) (resolved string, ok bool) {
+	absolute, elems := SplitPathname(target)
+	resolved = path.Clean(dir)
+	if absolute {
+		resolved = "."
+	}
+	for _, elem := range elems {
+		if elem != string(PrefixParent) {
+			resolved = path.Join(resolved, mapName(resolved, elem))
+		} else if resolved == "." {
+			return "", false
+		} else {
+			resolved = path.Dir(resolved)
+		}
+	}
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	return resolved, true
+}
+
+// IndexName maps a name as Index paths do, for ResolveLink
+func IndexName(parent, name string) string {
+	return strings.ToUpper(name)
+}
+
+// RelativePath returns the '/'-separated path leading from directory dir to target, both being
+// relative to the same top directory
+func RelativePath(dir, target string) string {
+	split := func(p string) []string {
+		if p = path.Clean(p); p == "." {
+			return nil
+		}
+		return strings.Split(p, "/")
+	}
+	from, to := split(dir), split(target)
+	for len(from) > 0 && len(to) > 0 && from[0] == to[0] {
+		from, to = from[1:], to[1:]
+	}
+	var elems []string
+	for range from {
+		elems = append(elems, "..")
+	}
+	elems = append(elems, to...)
+	if len(elems) == 0 {
+		return "."
+	}
+	return strings.Join(elems, "/")
+}
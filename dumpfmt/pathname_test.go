@@ -0,0 +1,65 @@
+package dumpfmt
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPathnames(t *testing.T) {
+	tests := []struct {
+		pathname  string
+		absolute  bool
+		elems     []string
+		formatted string // if different from pathname
+		resolved  string // from directory UDD/FRED, "" if outside the top
+	}{
+		{":UDD:JIM:A.SR", true, []string{"UDD", "JIM", "A.SR"}, "", "UDD/JIM/A.SR"},
+		{"^A.TXT", false, []string{"^", "A.TXT"}, "", "UDD/A.TXT"},
+		{"^^^^X", false, []string{"^", "^", "^", "^", "X"}, "", ""},
+		{"^:TOP", false, []string{"^", "TOP"}, "^TOP", "UDD/TOP"},
+		{"=SRC:B", false, []string{"SRC", "B"}, "SRC:B", "UDD/FRED/SRC/B"},
+		{"@CON0", true, []string{"PER", "CON0"}, ":PER:CON0", "PER/CON0"},
+		{":", true, nil, "", "."},
+	}
+	for _, tt := range tests {
+		absolute, elems := SplitPathname(tt.pathname)
+		if absolute != tt.absolute || !reflect.DeepEqual(elems, tt.elems) {
+			t.Errorf("%s: expected %v %q, got %v %q", tt.pathname, tt.absolute, tt.elems, absolute, elems)
+		}
+		want := tt.formatted
+		if want == "" {
+			want = tt.pathname
+		}
+		if got := FormatPathname(absolute, elems); got != want {
+			t.Errorf("%s: formatted as %s, expected %s", tt.pathname, got, want)
+		}
+		if got, ok := ResolveLink("UDD/FRED", tt.pathname, IndexName); got != tt.resolved || ok != (tt.resolved != "") {
+			t.Errorf("%s: resolved to %s (%v), expected %s", tt.pathname, got, ok, tt.resolved)
+		}
+	}
+}
+
+func TestResolveLinkMapping(t *testing.T) {
+	// each name is mapped within its resolved parent, and a mapped ".." must not escape
+	renamed := map[string]string{"UDD/Q?": "Q?~1"}
+	mapName := func(parent, name string) string {
+		if host, found := renamed[path.Join(parent, name)]; found {
+			return host
+		}
+		return strings.ToLower(name)
+	}
+	if got, ok := ResolveLink("UDD/FRED", "^Q?", mapName); !ok || got != "UDD/Q?~1" {
+		t.Errorf("Expected UDD/Q?~1, got %s, %v", got, ok)
+	}
+	if got, ok := ResolveLink("UDD", "SRC:^^X", mapName); !ok || got != "x" {
+		t.Errorf("Expected x, got %s, %v", got, ok)
+	}
+	if got, ok := ResolveLink("UDD", "..:..:X", IndexName); ok {
+		t.Errorf("Expected a name of .. leading above the top to be refused, got %s", got)
+	}
+	if got := RelativePath("UDD/FRED", "UDD/JIM/A"); got != "../JIM/A" {
+		t.Errorf("Expected ../JIM/A, got %s", got)
+	}
+}
@@ -0,0 +1,236 @@
+// reader.go - sequential reader for AOS/VS DUMP_II/III record streams
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"bytes"
+	"io"
+)
+
+// Reader returns the records of a dump one at a time.
+type Reader struct {
+	r        io.Reader
+	offset   int64
+	sod      *SOD
+	done     bool
+	skipData bool
+}
+
+// NewReader returns a Reader which reads a dump from r.
+// The caller should then call Next() repeatedly until it returns io.EOF.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Offset returns the number of bytes of the dump consumed so far.
+func (dr *Reader) Offset() int64 {
+	return dr.offset
+}
+
+// SOD returns the Start Of Dump record once it has been read, otherwise nil.
+func (dr *Reader) SOD() *SOD {
+	return dr.sod
+}
+
+// SkipData stops the contents of data blocks being read, they are seeked over if
+// the underlying reader is an io.Seeker.  The Data of each DataBlock is then nil.
+func (dr *Reader) SkipData(skip bool) {
+	dr.skipData = skip
+}
+
+// Next returns the next record in the dump.  The first record returned is always a *SOD.
+// After the *EndOfDump record has been returned Next returns io.EOF.
+func (dr *Reader) Next() (Record, error) {
+	if dr.done {
+		return nil, io.EOF
+	}
+	if dr.sod == nil {
+		sod, err := dr.readSod()
+		if err != nil {
+			return nil, err
+		}
+		dr.sod = sod
+		return sod, nil
+	}
+	hdr, err := dr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch hdr.RecordType {
+	case StartDumpType:
+		return nil, newFormatError(ErrDuplicateSOD, hdr, "")
+	case FSBType:
+		blob, err := dr.readBlob(hdr, hdr.RecordLength, "FSB")
+		if err != nil {
+			return nil, err
+		}
+		return &FSB{RecordHeader: hdr, Blob: blob, Fstat: DecodeFstat(blob)}, nil
+	case NameBlockType:
+		nameBytes, err := dr.readBlob(hdr, hdr.RecordLength, "file name")
+		if err != nil {
+			return nil, err
+		}
+		return &NameBlock{RecordHeader: hdr, FileName: string(bytes.Trim(nameBytes, "\x00"))}, nil
+	case UDAType:
+		uda, err := dr.readBlob(hdr, hdr.RecordLength, "UDA")
+		if err != nil {
+			return nil, err
+		}
+		return &UDA{RecordHeader: hdr, UDA: uda}, nil
+	case ACLType:
+		acl, err := dr.readBlob(hdr, hdr.RecordLength, "ACL")
+		if err != nil {
+			return nil, err
+		}
+		return &ACL{RecordHeader: hdr, ACL: acl}, nil
+	case LinkType:
+		target, err := dr.readBlob(hdr, hdr.RecordLength, "link target")
+		if err != nil {
+			return nil, err
+		}
+		return &Link{RecordHeader: hdr, LinkResolutionName: string(bytes.Trim(target, "\x00"))}, nil
+	case StartBlockType:
+		// nothing more to read - it's just a header
+		return &StartBlock{RecordHeader: hdr}, nil
+	case DataBlockType:
+		return dr.readDataBlock(hdr)
+	case EndBlockType:
+		return &EndBlock{RecordHeader: hdr}, nil
+	case EndDumpType:
+		dr.done = true
+		return &EndOfDump{RecordHeader: hdr}, nil
+	default:
+		return nil, newFormatError(ErrUnknownRecordType, hdr, "")
+	}
+}
+
+func (dr *Reader) readDataBlock(hdr RecordHeader) (*DataBlock, error) {
+	db := DataBlock{RecordHeader: hdr}
+
+	// first get the address and length
+	fourBytes, err := dr.readBlob(hdr, 4, "byte address")
+	if err != nil {
+		return nil, err
+	}
+	db.ByteAddress = DwordT(fourBytes[0])<<24 + DwordT(fourBytes[1])<<16 + DwordT(fourBytes[2])<<8 + DwordT(fourBytes[3])
+	fourBytes, err = dr.readBlob(hdr, 4, "byte length")
+	if err != nil {
+		return nil, err
+	}
+	db.ByteLength = DwordT(fourBytes[0])<<24 + DwordT(fourBytes[1])<<16 + DwordT(fourBytes[2])<<8 + DwordT(fourBytes[3])
+	if db.ByteLength > MaxBlockSize {
+		return nil, newFormatError(ErrBlockTooLarge, hdr, "%d vs. limit of %d", db.ByteLength, MaxBlockSize)
+	}
+	twoBytes, err := dr.readBlob(hdr, 2, "alignment count")
+	if err != nil {
+		return nil, err
+	}
+	db.AlignmentCount = WordT(twoBytes[0])<<8 + WordT(twoBytes[1])
+
+	// skip any alignment bytes - usually just one
+	if db.AlignmentCount > 0 {
+		if _, err = dr.readBlob(hdr, int(db.AlignmentCount), "alignment byte(s)"); err != nil {
+			return nil, err
+		}
+	}
+
+	if dr.skipData {
+		return &db, dr.skip(hdr, int64(db.ByteLength))
+	}
+	db.Data, err = dr.readBlob(hdr, int(db.ByteLength), "data block")
+	if err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
+
+// skip moves over byteLen bytes belonging to the record with header hdr
+func (dr *Reader) skip(hdr RecordHeader, byteLen int64) error {
+	if seeker, ok := dr.r.(io.Seeker); ok && byteLen > 0 {
+		// a seek beyond the end is not an error, so the last byte is read to check it is there
+		if _, err := seeker.Seek(byteLen-1, io.SeekCurrent); err != nil {
+			return err
+		}
+		dr.offset += byteLen - 1
+		_, err := dr.readBlob(hdr, 1, "data block")
+		return err
+	}
+	n, err := io.CopyN(io.Discard, dr.r, byteLen)
+	dr.offset += n
+	if err == io.EOF {
+		return newFormatError(ErrTruncated, hdr, "could not read data block, got %d of %d bytes", n, byteLen)
+	}
+	return err
+}
+
+// readBlob reads byteLen bytes belonging to the record with header hdr
+func (dr *Reader) readBlob(hdr RecordHeader, byteLen int, desc string) ([]byte, error) {
+	ba := make([]byte, byteLen)
+	n, err := io.ReadFull(dr.r, ba)
+	dr.offset += int64(n)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, newFormatError(ErrTruncated, hdr, "could not read %s, got %d of %d bytes", desc, n, byteLen)
+		}
+		return nil, err
+	}
+	return ba, nil
+}
+
+func (dr *Reader) readAWord(hdr RecordHeader) (WordT, error) {
+	twoBytes, err := dr.readBlob(hdr, 2, "DG Word")
+	if err != nil {
+		return 0, err
+	}
+	return WordT(twoBytes[0])<<8 | WordT(twoBytes[1]), nil
+}
+
+func (dr *Reader) readHeader() (RecordHeader, error) {
+	hdr := RecordHeader{RecordType: NoRecordType, Offset: dr.offset}
+	twoBytes, err := dr.readBlob(hdr, 2, "header")
+	if err != nil {
+		return hdr, err
+	}
+	hdr.RecordType = int(twoBytes[0]) >> 2 // 6-bit
+	hdr.RecordLength = int(twoBytes[0]&0x03)<<8 + int(twoBytes[1])
+	return hdr, nil
+}
+
+func (dr *Reader) readSod() (*SOD, error) {
+	var sod SOD
+	var err error
+	sod.RecordHeader, err = dr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if sod.RecordType != StartDumpType {
+		return nil, newFormatError(ErrMissingSOD, sod.RecordHeader, "")
+	}
+	for _, w := range []*WordT{&sod.DumpFormatRevision,
+		&sod.DumpTimeSecs, &sod.DumpTimeMins, &sod.DumpTimeHours,
+		&sod.DumpTimeDay, &sod.DumpTimeMonth, &sod.DumpTimeYear} {
+		if *w, err = dr.readAWord(sod.RecordHeader); err != nil {
+			return nil, err
+		}
+	}
+	return &sod, nil
+}
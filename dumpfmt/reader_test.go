@@ -0,0 +1,112 @@
+package dumpfmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func recHdr(recType, recLen int) []byte {
+	return []byte{byte(recType<<2 | recLen>>8), byte(recLen)}
+}
+
+func sodBytes() []byte {
+	return append(recHdr(StartDumpType, 14), 0, 16, 0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 0x07, 0xc6)
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		dump       []byte
+		want       error
+		offset     int64
+		recordType int
+	}{
+		{"empty", nil, ErrTruncated, 0, NoRecordType},
+		{"no SOD", recHdr(FSBType, 2), ErrMissingSOD, 0, FSBType},
+		{"second SOD", append(sodBytes(), sodBytes()...), ErrDuplicateSOD, 16, StartDumpType},
+		{"unknown type", append(sodBytes(), recHdr(42, 0)...), ErrUnknownRecordType, 16, 42},
+		{"short FSB", append(sodBytes(), append(recHdr(FSBType, 64), 1, 2, 3)...), ErrTruncated, 16, FSBType},
+		{"huge block", append(sodBytes(), append(recHdr(DataBlockType, 0), 0, 0, 0, 0, 0, 1, 0, 0, 0, 0)...), ErrBlockTooLarge, 16, DataBlockType},
+		{"no end of dump", sodBytes(), ErrTruncated, 16, NoRecordType},
+	}
+	for _, tt := range tests {
+		rdr := NewReader(bytes.NewReader(tt.dump))
+		var err error
+		for err == nil {
+			_, err = rdr.Next()
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			continue
+		}
+		var fe *FormatError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected a *FormatError, got %T", tt.name, err)
+			continue
+		}
+		if fe.Offset != tt.offset || fe.RecordType != tt.recordType {
+			t.Errorf("%s: expected offset %d type %d, got offset %d type %d",
+				tt.name, tt.offset, tt.recordType, fe.Offset, fe.RecordType)
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	dw := NewWriter(&buf)
+	modified := time.Date(1991, time.March, 4, 13, 14, 16, 0, time.UTC)
+	acl := []ACLEntry{{UserPattern: "OP", Access: AccessOwner | AccessRead}}
+	data := []byte("A NEW LINE\n")
+	for _, err := range []error{
+		dw.WriteSOD(SOD{DumpFormatRevision: 16, DumpTimeYear: 1991}),
+		dw.WriteFSB(Fstat{EntryType: 68, Modified: modified, FileLength: 11}),
+		dw.WriteName("NOTE.TXT"),
+		dw.WriteACL(acl),
+		dw.WriteStartBlock(),
+		dw.WriteDataBlock(0, data),
+		dw.WriteEndBlock(),
+		dw.WriteEndOfDump(),
+	} {
+		if err != nil {
+			t.Fatalf("Unexpected error writing dump: %v", err)
+		}
+	}
+	rdr := NewReader(&buf)
+	var types []int
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading dump: %v", err)
+		}
+		types = append(types, rec.Header().RecordType)
+		switch r := rec.(type) {
+		case *FSB:
+			if r.Fstat.EntryType != 68 || !r.Fstat.Modified.Equal(modified) || r.Fstat.FileLength != 11 {
+				t.Errorf("FSTAT did not survive round trip: %+v", r.Fstat)
+			}
+		case *NameBlock:
+			if r.FileName != "NOTE.TXT" {
+				t.Errorf("Expected name NOTE.TXT, got %s", r.FileName)
+			}
+		case *ACL:
+			if FormatACL(r.Entries()) != "OP,OR" {
+				t.Errorf("Expected ACL OP,OR, got %s", FormatACL(r.Entries()))
+			}
+		case *DataBlock:
+			if !bytes.Equal(r.Data, data) || r.ByteAddress != 0 {
+				t.Errorf("Data block did not survive round trip: %+v", r)
+			}
+		}
+	}
+	want := []int{StartDumpType, FSBType, NameBlockType, ACLType, StartBlockType, DataBlockType, EndBlockType, EndDumpType}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Errorf("Expected record types %v, got %v", want, types)
+	}
+}
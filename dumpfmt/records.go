@@ -0,0 +1,203 @@
+// records.go - splitting of AOS/VS file contents into records
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// the default delimiters of data-sensitive records
+const (
+	delimNUL = 000
+	delimNL  = 012
+	delimFF  = 014
+	delimCR  = 015
+)
+
+// variableHeaderBytes is the length of the ASCII length header of each variable-length record
+const variableHeaderBytes = 4
+
+// RecordWriter splits the contents of a file, as they are written to it, into records according
+// to the record format in the file's FSTAT packet, passing each record to a function.
+//
+// Data-sensitive records end with NL, CR, FF or NUL; the delimiter is not included in the record
+// except for FF, which is kept as it marks a new page.  CR NL counts as a single delimiter and NULs
+// between records are ignored, unknown formats are also split as data-sensitive.
+// Dynamic and undefined formats have no record structure so the whole file is one record.
+// Fixed-length records are FSTAT record length bytes long; variable-length records have a 4-byte
+// ASCII header giving their length including the header; and IBM variable block records are
+// in blocks with 4-byte binary block and record descriptor words.
+type RecordWriter struct {
+	format  byte
+	fixed   int
+	emit    func(rec []byte) error
+	buf     []byte
+	afterCR bool
+	block   int // bytes left in the current IBM variable block
+}
+
+// NewRecordWriter returns a RecordWriter for a file with the given FSTAT packet
+func NewRecordWriter(fs Fstat, emit func(rec []byte) error) *RecordWriter {
+	rw := &RecordWriter{format: fs.RecordFormat, fixed: int(fs.RecordLength), emit: emit}
+	if rw.format == RecFmtFixed && rw.fixed == 0 {
+		rw.format = RecFmtDataSensitive
+	}
+	return rw
+}
+
+// Write accepts more of the file's contents, emitting each record that is completed
+func (rw *RecordWriter) Write(p []byte) (int, error) {
+	rw.buf = append(rw.buf, p...)
+	var used int
+	var err error
+	switch rw.format {
+	case RecFmtFixed:
+		used, err = rw.splitFixed()
+	case RecFmtVariable:
+		used, err = rw.splitVariable()
+	case RecFmtVariableBlock:
+		used, err = rw.splitVariableBlock()
+	case RecFmtDynamic, RecFmtUndefined:
+		// emitted by Close
+		return len(p), nil
+	default:
+		used, err = rw.splitDataSensitive()
+	}
+	rw.buf = append(rw.buf[:0], rw.buf[used:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close emits any incomplete final record, or the whole file if it has no record structure
+func (rw *RecordWriter) Close() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	rec := rw.buf
+	rw.buf = nil
+	return rw.emit(rec)
+}
+
+func (rw *RecordWriter) splitDataSensitive() (int, error) {
+	start := 0
+	for i, b := range rw.buf {
+		afterCR := rw.afterCR
+		rw.afterCR = false
+		switch b {
+		case delimNL:
+			if afterCR && i == start {
+				// the NL of a CR NL pair
+				start = i + 1
+				continue
+			}
+		case delimCR:
+			rw.afterCR = true
+		case delimFF:
+			if err := rw.emit(rw.buf[start : i+1]); err != nil {
+				return start, err
+			}
+			start = i + 1
+			continue
+		case delimNUL:
+			if i == start {
+				start = i + 1
+				continue
+			}
+		default:
+			continue
+		}
+		if err := rw.emit(rw.buf[start:i]); err != nil {
+			return start, err
+		}
+		start = i + 1
+	}
+	return start, nil
+}
+
+func (rw *RecordWriter) splitFixed() (int, error) {
+	start := 0
+	for ; len(rw.buf)-start >= rw.fixed; start += rw.fixed {
+		if err := rw.emit(rw.buf[start : start+rw.fixed]); err != nil {
+			return start, err
+		}
+	}
+	return start, nil
+}
+
+func (rw *RecordWriter) splitVariable() (int, error) {
+	start := 0
+	for len(rw.buf)-start >= variableHeaderBytes {
+		hdr := string(rw.buf[start : start+variableHeaderBytes])
+		if hdr == "\x00\x00\x00\x00" {
+			// NULs following the last record
+			return len(rw.buf), nil
+		}
+		length, err := strconv.Atoi(hdr)
+		if err != nil || length < variableHeaderBytes {
+			return start, fmt.Errorf("invalid variable-length record header %q", hdr)
+		}
+		if len(rw.buf)-start < length {
+			break
+		}
+		if err = rw.emit(rw.buf[start+variableHeaderBytes : start+length]); err != nil {
+			return start, err
+		}
+		start += length
+	}
+	return start, nil
+}
+
+func (rw *RecordWriter) splitVariableBlock() (int, error) {
+	start := 0
+	for len(rw.buf)-start >= 4 {
+		length := int(rw.buf[start])<<8 | int(rw.buf[start+1])
+		if rw.block == 0 {
+			// block descriptor word
+			if length == 0 {
+				// NULs following the last block
+				return len(rw.buf), nil
+			}
+			if length < 4 {
+				return start, fmt.Errorf("invalid block descriptor word, length %d", length)
+			}
+			rw.block = length - 4
+			start += 4
+			continue
+		}
+		// record descriptor word
+		if length < 4 || length > rw.block {
+			return start, fmt.Errorf("invalid record descriptor word, length %d", length)
+		}
+		if len(rw.buf)-start < length {
+			break
+		}
+		if err := rw.emit(rw.buf[start+4 : start+length]); err != nil {
+			return start, err
+		}
+		rw.block -= length
+		start += length
+	}
+	return start, nil
+}
@@ -0,0 +1,48 @@
+package dumpfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		fstat  Fstat
+		data   string
+		want   []string
+		hasErr bool
+	}{
+		{"data sensitive", Fstat{RecordFormat: RecFmtDataSensitive}, "ONE\nTWO\r\nPAGE\fTHREE\rFOUR\x00\x00\nLAST",
+			[]string{"ONE", "TWO", "PAGE\f", "THREE", "FOUR", "", "LAST"}, false},
+		{"fixed", Fstat{RecordFormat: RecFmtFixed, RecordLength: 4}, "AAAABBBBCC", []string{"AAAA", "BBBB", "CC"}, false},
+		{"fixed no length", Fstat{RecordFormat: RecFmtFixed}, "A\nB\n", []string{"A", "B"}, false},
+		{"variable", Fstat{RecordFormat: RecFmtVariable}, "0007ONE00040010FOURTH\x00\x00\x00\x00", []string{"ONE", "", "FOURTH"}, false},
+		{"bad variable", Fstat{RecordFormat: RecFmtVariable}, "0007ONE000AFOURTH", []string{"ONE"}, true},
+		{"undefined", Fstat{RecordFormat: RecFmtUndefined}, "ONE\nTWO\n", []string{"ONE\nTWO\n"}, false},
+		{"IBM variable block", Fstat{RecordFormat: RecFmtVariableBlock},
+			"\x00\x0f\x00\x00\x00\x07\x00\x00ONE\x00\x04\x00\x00\x00\x0a\x00\x00\x00\x06\x00\x00AB\x00\x00\x00\x00",
+			[]string{"ONE", "", "AB"}, false},
+	}
+	for _, tt := range tests {
+		var got []string
+		rw := NewRecordWriter(tt.fstat, func(rec []byte) error {
+			got = append(got, string(rec))
+			return nil
+		})
+		var err error
+		// a byte at a time to split records across writes
+		for i := 0; i < len(tt.data) && err == nil; i++ {
+			_, err = rw.Write([]byte{tt.data[i]})
+		}
+		if err == nil {
+			err = rw.Close()
+		}
+		if (err != nil) != tt.hasErr {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected records %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// resync.go - recovery from damaged dumps
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNotSeekable is returned by Resync if the dump is not being read from an io.Seeker
+var ErrNotSeekable = errors.New("cannot resynchronise a dump that is not seekable")
+
+// Resync scans forward from the byte after offset from, usually the Offset of a FormatError,
+// for a plausible FSB record followed by a name block.  It returns the offset of the FSB, which
+// will be the next record returned by Next, or io.EOF if no further entry is found.
+// The dump must be read from an io.Seeker.
+func (dr *Reader) Resync(from int64) (int64, error) {
+	seeker, ok := dr.r.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+	// the Reader's offset is relative to where it started reading
+	base, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	base -= dr.offset
+	pos := from + 1
+	if _, err = seeker.Seek(base+pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReaderSize(dr.r, 2*(maxRecordLength+2))
+	for {
+		candidate, err := br.Peek(2 + maxRecordLength + 2 + MaxNameBlockBytes)
+		if len(candidate) < 4 {
+			if err == nil || err == io.EOF || err == bufio.ErrBufferFull {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if plausibleEntry(candidate) {
+			if _, err = seeker.Seek(base+pos, io.SeekStart); err != nil {
+				return 0, err
+			}
+			dr.offset = pos
+			dr.done = false
+			if dr.sod == nil {
+				// the SOD was lost, so carry on without it
+				dr.sod = &SOD{}
+			}
+			return pos, nil
+		}
+		br.Discard(1)
+		pos++
+	}
+}
+
+// plausibleEntry reports whether b starts with an FSB record of a known entry type followed by a name block
+func plausibleEntry(b []byte) bool {
+	if int(b[0])>>2 != FSBType {
+		return false
+	}
+	fsbLen := int(b[0]&0x03)<<8 + int(b[1])
+	if fsbLen < 2 || len(b) < 2+fsbLen+2 {
+		return false
+	}
+	if _, known := KnownFstatEntryTypes[b[3]]; !known {
+		return false
+	}
+	name := b[2+fsbLen:]
+	if int(name[0])>>2 != NameBlockType {
+		return false
+	}
+	nameLen := int(name[0]&0x03)<<8 + int(name[1])
+	if nameLen < 2 || nameLen > MaxNameBlockBytes || len(name) < 2+nameLen {
+		return false
+	}
+	// at least one legal character then NULs
+	body := name[2 : 2+nameLen]
+	end := bytes.IndexByte(body, 0)
+	if end < 1 {
+		return false
+	}
+	for _, c := range body[:end] {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '$' || c == '?') {
+			return false
+		}
+	}
+	return len(bytes.Trim(body[end:], "\x00")) == 0
+}
@@ -0,0 +1,150 @@
+// volumes.go - multi-volume dumps
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// sodRecordBytes is the length of a Start Of Dump record including its header
+const sodRecordBytes = 2 + 14
+
+// volume is one part of a multi-volume dump
+type volume struct {
+	r     *io.SectionReader
+	skip  int64 // bytes at the start of the volume which are not part of the logical dump
+	start int64 // offset of the volume in the logical dump
+}
+
+// Volumes joins the volumes of a dump written across several tapes or files into a single
+// logical dump which may be read, seeked and read at like a single-volume dump.
+type Volumes struct {
+	vols []volume
+	size int64
+	pos  int64
+}
+
+var (
+	_ io.ReadSeeker = (*Volumes)(nil)
+	_ io.ReaderAt   = (*Volumes)(nil)
+)
+
+// JoinVolumes returns the logical dump formed by the volumes in order.  A volume after the
+// first which begins with its own Start Of Dump record must match the first volume, ie. be
+// from the same dump, its Start Of Dump record is then dropped.  Other volumes are simply
+// concatenated.
+func JoinVolumes(vols ...*io.SectionReader) (*Volumes, error) {
+	v := &Volumes{}
+	first := make([]byte, sodRecordBytes)
+	if len(vols) > 0 {
+		if _, err := vols[0].ReadAt(first, 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	for i, r := range vols {
+		vol := volume{r: r, start: v.size}
+		if i > 0 {
+			sod := make([]byte, sodRecordBytes)
+			n, err := r.ReadAt(sod, 0)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			if n == sodRecordBytes && isSODHeader(sod) {
+				if !bytes.Equal(sod, first) {
+					return nil, fmt.Errorf("%w: volume %d does not have the same Start Of Dump record as volume 1", ErrVolumeSequence, i+1)
+				}
+				vol.skip = sodRecordBytes
+			}
+		}
+		v.size += r.Size() - vol.skip
+		v.vols = append(v.vols, vol)
+	}
+	return v, nil
+}
+
+func isSODHeader(b []byte) bool {
+	return int(b[0])>>2 == StartDumpType && int(b[0]&0x03)<<8+int(b[1]) == sodRecordBytes-2
+}
+
+// Size returns the length of the logical dump
+func (v *Volumes) Size() int64 {
+	return v.size
+}
+
+// Locate returns the volume number, from 1, and the offset within that volume of an offset in the logical dump
+func (v *Volumes) Locate(offset int64) (int, int64) {
+	i := sort.Search(len(v.vols), func(i int) bool { return v.vols[i].start > offset }) - 1
+	if i < 0 {
+		return 1, offset
+	}
+	return i + 1, offset - v.vols[i].start + v.vols[i].skip
+}
+
+// ReadAt reads from the logical dump, crossing volume boundaries as required
+func (v *Volumes) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		if off >= v.size {
+			return read, io.EOF
+		}
+		vn, voff := v.Locate(off)
+		vol := v.vols[vn-1]
+		remaining := vol.r.Size() - voff
+		chunk := p[read:]
+		if int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := vol.r.ReadAt(chunk, voff)
+		read += n
+		off += int64(n)
+		if err != nil && !(err == io.EOF && n == len(chunk)) {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func (v *Volumes) Read(p []byte) (int, error) {
+	n, err := v.ReadAt(p, v.pos)
+	v.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (v *Volumes) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += v.pos
+	case io.SeekEnd:
+		offset += v.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek to negative offset %d", offset)
+	}
+	v.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,60 @@
+package dumpfmt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestJoinVolumes(t *testing.T) {
+	var buf bytes.Buffer
+	dw := NewWriter(&buf)
+	for _, err := range []error{
+		dw.WriteSOD(SOD{DumpFormatRevision: 16, DumpTimeYear: 1993}),
+		dw.WriteFSB(Fstat{EntryType: 68}),
+		dw.WriteName("SPLIT"),
+		dw.WriteStartBlock(),
+		dw.WriteDataBlock(0, bytes.Repeat([]byte("0123456789"), 10)),
+		dw.WriteEndBlock(),
+		dw.WriteEndOfDump(),
+	} {
+		if err != nil {
+			t.Fatalf("Unexpected error writing dump: %v", err)
+		}
+	}
+	whole := buf.Bytes()
+	sod := whole[:sodRecordBytes]
+	split := len(whole) - 50 // within the data block
+	section := func(b []byte) *io.SectionReader { return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))) }
+	other := append([]byte{}, sod...)
+	other[len(other)-1]++ // a different dump year
+
+	tests := []struct {
+		name string
+		vol2 []byte
+		want error
+	}{
+		{"with SOD", append(append([]byte{}, sod...), whole[split:]...), nil},
+		{"concatenated", whole[split:], nil},
+		{"wrong dump", append(other, whole[split:]...), ErrVolumeSequence},
+	}
+	for _, tt := range tests {
+		vols, err := JoinVolumes(section(whole[:split]), section(tt.vol2))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.want, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		joined, err := io.ReadAll(vols)
+		if err != nil || !bytes.Equal(joined, whole) {
+			t.Errorf("%s: joined volumes differ from the original dump, %v", tt.name, err)
+		}
+		vol, off := vols.Locate(int64(split) + 2)
+		if vol != 2 || off != int64(len(tt.vol2)-len(whole[split:])+2) {
+			t.Errorf("%s: expected offset in volume 2, got volume %d offset %d", tt.name, vol, off)
+		}
+	}
+}
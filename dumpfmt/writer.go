@@ -0,0 +1,151 @@
+// writer.go - creation of AOS/VS DUMP_II record streams
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dumpfmt
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxRecordLength is the largest length that fits in the 10-bit length field of a record header
+const maxRecordLength = 1023
+
+// DataHeaderBytes is the length of the data block header, following the record header, written by Writer
+const DataHeaderBytes = 10
+
+// Writer creates a dump record by record, the caller is responsible for the
+// ordering of the records.  A directory is written as FSB, name, ACL, its contents
+// and then an end block; a file as FSB, name, ACL, start block, data blocks and an end block;
+// and a link as FSB, name, ACL and link.
+type Writer struct {
+	w      io.Writer
+	offset int64
+}
+
+// NewWriter returns a Writer which writes a dump to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Offset returns the number of bytes written so far
+func (dw *Writer) Offset() int64 {
+	return dw.offset
+}
+
+func (dw *Writer) write(b []byte) error {
+	n, err := dw.w.Write(b)
+	dw.offset += int64(n)
+	return err
+}
+
+func (dw *Writer) writeHeader(recType, recLen int) error {
+	if recLen > maxRecordLength {
+		return fmt.Errorf("record of type %d too long (%d bytes, limit is %d)", recType, recLen, maxRecordLength)
+	}
+	return dw.write([]byte{byte(recType<<2 | recLen>>8), byte(recLen)})
+}
+
+func (dw *Writer) writeRecord(recType int, body []byte) error {
+	if err := dw.writeHeader(recType, len(body)); err != nil {
+		return err
+	}
+	return dw.write(body)
+}
+
+// WriteSOD writes the Start Of Dump record, which must come first
+func (dw *Writer) WriteSOD(sod SOD) error {
+	body := make([]byte, 0, 14)
+	for _, w := range []WordT{sod.DumpFormatRevision,
+		sod.DumpTimeSecs, sod.DumpTimeMins, sod.DumpTimeHours,
+		sod.DumpTimeDay, sod.DumpTimeMonth, sod.DumpTimeYear} {
+		body = append(body, byte(w>>8), byte(w))
+	}
+	return dw.writeRecord(StartDumpType, body)
+}
+
+// WriteFSB writes the FSTAT packet of the next entry
+func (dw *Writer) WriteFSB(fs Fstat) error {
+	return dw.writeRecord(FSBType, EncodeFstat(fs))
+}
+
+// WriteName writes the name of the current entry
+func (dw *Writer) WriteName(name string) error {
+	return dw.writeRecord(NameBlockType, append([]byte(name), 0))
+}
+
+// WriteUDA writes a User Data Area for the current entry
+func (dw *Writer) WriteUDA(uda []byte) error {
+	return dw.writeRecord(UDAType, uda)
+}
+
+// WriteACL writes the Access Control List of the current entry
+func (dw *Writer) WriteACL(entries []ACLEntry) error {
+	return dw.writeRecord(ACLType, EncodeACL(entries))
+}
+
+// WriteLink writes the resolution name of a link, using ':' separators
+func (dw *Writer) WriteLink(target string) error {
+	return dw.writeRecord(LinkType, append([]byte(target), 0))
+}
+
+// WriteStartBlock begins the data of a file
+func (dw *Writer) WriteStartBlock() error {
+	return dw.writeHeader(StartBlockType, 0)
+}
+
+// WriteDataBlock writes data to be loaded at byteAddress in the current file.
+// Areas of the file that are not written will be loaded as NULLs.
+func (dw *Writer) WriteDataBlock(byteAddress int64, data []byte) error {
+	if len(data) > MaxBlockSize {
+		return fmt.Errorf("data block too large (%d bytes, limit is %d)", len(data), MaxBlockSize)
+	}
+	if err := dw.writeHeader(DataBlockType, DataHeaderBytes); err != nil {
+		return err
+	}
+	// the data itself is word-aligned
+	var alignment WordT
+	if (dw.offset+DataHeaderBytes)%2 != 0 {
+		alignment = 1
+	}
+	hdr := []byte{
+		byte(byteAddress >> 24), byte(byteAddress >> 16), byte(byteAddress >> 8), byte(byteAddress),
+		byte(len(data) >> 24), byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data)),
+		byte(alignment >> 8), byte(alignment),
+	}
+	if alignment > 0 {
+		hdr = append(hdr, 0)
+	}
+	if err := dw.write(hdr); err != nil {
+		return err
+	}
+	return dw.write(data)
+}
+
+// WriteEndBlock ends the current file or directory
+func (dw *Writer) WriteEndBlock() error {
+	return dw.writeHeader(EndBlockType, 0)
+}
+
+// WriteEndOfDump writes the final record of the dump
+func (dw *Writer) WriteEndOfDump() error {
+	return dw.writeHeader(EndDumpType, 0)
+}
@@ -0,0 +1,402 @@
+// dumpg.go
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// dumpg creates an AOS/VS DUMP_II file from a directory tree on the host so that
+// it may be loaded onto an AOS/VS system with LOAD_II.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+const semVer = "v1.1.0"
+
+const maxNameLen = 31 // AOS/VS filename limit
+
+// program flags (options)...
+var (
+	verbose, version        bool
+	aclStr, dump, sourceDir string
+	nameMapFile             string
+	nameMap                 map[string]string // host paths relative to -dir to AOS/VS names
+	dumpFileInfo            os.FileInfo       // the dump being written, which must not be dumped itself
+	revision                uint
+	typeMappings            typeMapFlag
+	defaultACL              []dumpfmt.ACLEntry
+	defaultTypeByExtension  = map[string]string{".CLI": "FTXT", ".TXT": "FTXT", ".SR": "FTXT", ".F77": "FTXT", ".C": "FTXT", ".H": "FTXT", ".COB": "FTXT", ".PL1": "FTXT", ".PAS": "FTXT", ".LS": "FTXT", ".MAC": "FTXT", ".PR": "FPRG", ".ST": "FSTF"}
+	defaultTypeMnemonic     = "FUDF"
+	zeroBlock               = make([]byte, dumpfmt.MaxBlockSize)
+)
+
+// typeMapFlag is a repeatable -type .EXT=MNEMONIC flag.Value
+type typeMapFlag map[string]string
+
+func (tm typeMapFlag) String() string {
+	var strs []string
+	for ext, mnem := range tm {
+		strs = append(strs, ext+"="+mnem)
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, ",")
+}
+
+func (tm typeMapFlag) Set(s string) error {
+	parts := strings.Split(s, "=")
+	if len(parts) != 2 {
+		return fmt.Errorf("expected .EXT=MNEMONIC, eg. .CLI=FTXT")
+	}
+	mnem := strings.ToUpper(parts[1])
+	if _, known := dumpfmt.FstatTypeByMnemonic(mnem); !known {
+		return fmt.Errorf("unknown file type mnemonic <%s>", parts[1])
+	}
+	ext := strings.ToUpper(parts[0])
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	tm[ext] = mnem
+	return nil
+}
+
+func init() {
+	typeMappings = typeMapFlag{}
+	flag.StringVar(&dump, "dumpFile", "", "DUMP_II file to create")
+	flag.StringVar(&dump, "d", "", "DUMP_II file to create")
+	flag.StringVar(&sourceDir, "dir", ".", "directory whose contents are to be dumped")
+	flag.StringVar(&aclStr, "acl", "+,RE", "ACL to give every dumped entry, the default only allows reading, eg. \"SMERRONY,OWARE +,RE\"")
+	flag.StringVar(&nameMapFile, "nameMap", "", "restore the AOS/VS names recorded by loadg -nameMap in this file")
+	flag.UintVar(&revision, "revision", 16, "DUMP format revision to write")
+	flag.Var(typeMappings, "type", "file type for an extension, eg. .CLI=FTXT (may be repeated)")
+	flag.BoolVar(&verbose, "verbose", false, "be rather wordy about what dumpg is doing")
+	flag.BoolVar(&verbose, "v", false, "be rather wordy about what dumpg is doing")
+	flag.BoolVar(&version, "version", false, "show the version number of dumpg and exit")
+	flag.BoolVar(&version, "V", false, "show the version number of dumpg and exit")
+}
+
+func main() {
+	flag.Parse()
+	if version || verbose {
+		fmt.Printf("dumpg version %s\n", semVer)
+		if !verbose {
+			return
+		}
+	}
+	if len(dump) == 0 {
+		log.Fatalln("ERROR: Must specify DUMP file name with -dumpFile <dumpfilename> option")
+	}
+	var err error
+	if defaultACL, err = dumpfmt.ParseACL(aclStr); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if nameMapFile != "" {
+		if nameMap, err = readNameMap(nameMapFile); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+	}
+	dumpFile, err := os.Create(dump)
+	if err != nil {
+		log.Fatalf("ERROR: Could not create dump file <%s> due to %v", dump, err)
+	}
+	if dumpFileInfo, err = dumpFile.Stat(); err != nil {
+		log.Fatalf("ERROR: Could not stat dump file <%s> due to %v", dump, err)
+	}
+	bufWriter := bufio.NewWriter(dumpFile)
+	dw := dumpfmt.NewWriter(bufWriter)
+
+	now := time.Now()
+	sod := dumpfmt.SOD{
+		DumpFormatRevision: dumpfmt.WordT(revision),
+		DumpTimeSecs:       dumpfmt.WordT(now.Second()),
+		DumpTimeMins:       dumpfmt.WordT(now.Minute()),
+		DumpTimeHours:      dumpfmt.WordT(now.Hour()),
+		DumpTimeDay:        dumpfmt.WordT(now.Day()),
+		DumpTimeMonth:      dumpfmt.WordT(now.Month()),
+		DumpTimeYear:       dumpfmt.WordT(now.Year()),
+	}
+	if err = dw.WriteSOD(sod); err != nil {
+		log.Fatalf("ERROR: Could not write to dump file due to %v", err)
+	}
+	if err = dumpDirContents(dw, sourceDir); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err = dw.WriteEndOfDump(); err != nil {
+		log.Fatalf("ERROR: Could not write to dump file due to %v", err)
+	}
+	if err = bufWriter.Flush(); err != nil {
+		log.Fatalf("ERROR: Could not write to dump file due to %v", err)
+	}
+	if err = dumpFile.Close(); err != nil {
+		log.Fatalf("ERROR: Could not close dump file due to %v", err)
+	}
+	if verbose {
+		fmt.Printf("Wrote %d bytes to %s\n", dw.Offset(), dump)
+	}
+}
+
+// dumpDirContents writes every entry in dir, recursing into subdirectories
+func dumpDirContents(dw *dumpfmt.Writer, dir string) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read directory <%s> due to %v", dir, err)
+	}
+	taken := map[string]string{} // AOS/VS names already used in this directory to their host names
+	for _, de := range dirEntries {
+		hostPath := filepath.Join(dir, de.Name())
+		info, err := os.Lstat(hostPath)
+		if err != nil {
+			return fmt.Errorf("could not stat <%s> due to %v", hostPath, err)
+		}
+		if dumpFileInfo != nil && os.SameFile(info, dumpFileInfo) {
+			if verbose {
+				fmt.Printf("Skipping the dump file itself: %s\n", hostPath)
+			}
+			continue
+		}
+		name, mapped := mappedName(hostPath)
+		if !mapped {
+			name = aosvsName(de.Name())
+		}
+		if other, clash := taken[name]; clash {
+			unique := uniqueName(name, taken)
+			log.Printf("WARNING: Host name <%s> would collide with <%s> as <%s>, it will be dumped as <%s>", de.Name(), other, name, unique)
+			name = unique
+		}
+		taken[name] = de.Name()
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			err = dumpLink(dw, hostPath, name, info)
+		case info.IsDir():
+			err = dumpDir(dw, hostPath, name, info)
+		case info.Mode().IsRegular():
+			err = dumpPlainFile(dw, hostPath, name, info)
+		default:
+			log.Printf("WARNING: Skipping <%s> which is neither a file, directory or link", hostPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dumpDir(dw *dumpfmt.Writer, hostPath, name string, info os.FileInfo) error {
+	if verbose {
+		fmt.Printf("Directory: %s -> %s\n", hostPath, name)
+	}
+	fs := hostFstat(info, dumpfmt.FdirType)
+	if err := writeEntryHeader(dw, fs, name); err != nil {
+		return err
+	}
+	if err := dumpDirContents(dw, hostPath); err != nil {
+		return err
+	}
+	return dw.WriteEndBlock()
+}
+
+func dumpLink(dw *dumpfmt.Writer, hostPath, name string, info os.FileInfo) error {
+	target, err := os.Readlink(hostPath)
+	if err != nil {
+		return fmt.Errorf("could not read link <%s> due to %v", hostPath, err)
+	}
+	// convert to AOS/VS form, eg. "^A.TXT" for "../a.txt"
+	slashed := filepath.ToSlash(target)
+	var elems []string
+	for _, part := range strings.Split(slashed, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			elems = append(elems, string(dumpfmt.PrefixParent))
+		default:
+			elems = append(elems, aosvsName(part))
+		}
+	}
+	aosvsTarget := dumpfmt.FormatPathname(strings.HasPrefix(slashed, "/"), elems)
+	if verbose {
+		fmt.Printf("Link: %s -> %s => %s\n", hostPath, name, aosvsTarget)
+	}
+	if err = writeEntryHeader(dw, hostFstat(info, dumpfmt.FlnkType), name); err != nil {
+		return err
+	}
+	return dw.WriteLink(aosvsTarget)
+}
+
+func dumpPlainFile(dw *dumpfmt.Writer, hostPath, name string, info os.FileInfo) error {
+	entryType := fileType(name)
+	if verbose {
+		fmt.Printf("File: %s -> %s (%s, %d bytes)\n", hostPath, name, dumpfmt.KnownFstatEntryTypes[entryType].DgMnemonic, info.Size())
+	}
+	fs := hostFstat(info, entryType)
+	fs.FileLength = dumpfmt.DwordT(info.Size())
+	if entryType == dumpfmt.FtxtType {
+		fs.RecordFormat = dumpfmt.RecFmtDataSensitive
+	}
+	if err := writeEntryHeader(dw, fs, name); err != nil {
+		return err
+	}
+	if err := dw.WriteStartBlock(); err != nil {
+		return err
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return fmt.Errorf("could not open <%s> due to %v", hostPath, err)
+	}
+	defer f.Close()
+	buf := make([]byte, dumpfmt.MaxBlockSize)
+	var addr int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			// skip over blocks of NULLs, but not at the end so that the length is preserved
+			if !bytes.Equal(buf[:n], zeroBlock[:n]) || addr+int64(n) >= info.Size() {
+				if werr := dw.WriteDataBlock(addr, buf[:n]); werr != nil {
+					return werr
+				}
+			}
+			addr += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read <%s> due to %v", hostPath, err)
+		}
+	}
+	return dw.WriteEndBlock()
+}
+
+func writeEntryHeader(dw *dumpfmt.Writer, fs dumpfmt.Fstat, name string) error {
+	if err := dw.WriteFSB(fs); err != nil {
+		return err
+	}
+	if err := dw.WriteName(name); err != nil {
+		return err
+	}
+	return dw.WriteACL(defaultACL)
+}
+
+// hostFstat builds an FSTAT packet for a host file using the AOS/VS CREATE defaults
+func hostFstat(info os.FileInfo, entryType byte) dumpfmt.Fstat {
+	modified := aosvsTime(info.ModTime())
+	fs := dumpfmt.Fstat{
+		RecordFormat:   dumpfmt.RecFmtDynamic,
+		EntryType:      entryType,
+		Created:        modified,
+		Accessed:       modified,
+		Modified:       modified,
+		ElementSize:    4,
+		MaxIndexLevels: 3,
+	}
+	if entryType == dumpfmt.FdirType {
+		fs.HashFrameSize = 7
+	}
+	return fs
+}
+
+// aosvsTime returns the host wall-clock time in the zone-less form used in FSTAT packets
+func aosvsTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// fileType chooses the FSTAT entry type from the name's extension
+func fileType(name string) byte {
+	mnem, found := typeMappings[strings.ToUpper(filepath.Ext(name))]
+	if !found {
+		mnem, found = defaultTypeByExtension[strings.ToUpper(filepath.Ext(name))]
+	}
+	if !found {
+		mnem = defaultTypeMnemonic
+	}
+	et, _ := dumpfmt.FstatTypeByMnemonic(mnem)
+	return et
+}
+
+// readNameMap reads a file of "host path<TAB>AOS/VS pathname" lines written by loadg -nameMap
+func readNameMap(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open name map <%s> due to %v", name, err)
+	}
+	defer f.Close()
+	nm := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line in name map <%s>: %s", name, scanner.Text())
+		}
+		aosvsPath := strings.Split(fields[1], ":")
+		nm[fields[0]] = aosvsPath[len(aosvsPath)-1]
+	}
+	return nm, scanner.Err()
+}
+
+// mappedName returns the AOS/VS name given for the host file in the -nameMap file, if any
+func mappedName(hostPath string) (string, bool) {
+	rel, err := filepath.Rel(sourceDir, hostPath)
+	if err != nil {
+		return "", false
+	}
+	name, found := nameMap[filepath.ToSlash(rel)]
+	return name, found
+}
+
+// aosvsName maps a host file name to a legal AOS/VS one - upper-case letters, digits, '.', '$', '?' and '_'
+// no longer than 31 characters
+func aosvsName(hostName string) string {
+	name := []byte(strings.ToUpper(hostName))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '$' || c == '?' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > maxNameLen {
+		name = name[:maxNameLen]
+	}
+	if string(name) != strings.ToUpper(hostName) {
+		log.Printf("WARNING: Host name <%s> will be dumped as <%s>", hostName, name)
+	}
+	return string(name)
+}
+
+// uniqueName adds the smallest _N suffix that makes name unused in its directory, shortening it to fit if necessary
+func uniqueName(name string, taken map[string]string) string {
+	for n := 1; ; n++ {
+		suffix := fmt.Sprintf("_%d", n)
+		base := name
+		if len(base)+len(suffix) > maxNameLen {
+			base = base[:maxNameLen-len(suffix)]
+		}
+		if _, clash := taken[base+suffix]; !clash {
+			return base + suffix
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// dumpTree dumps the host directory dir as dumpg would
+func dumpTree(t *testing.T, dir string) []byte {
+	var buf bytes.Buffer
+	dw := dumpfmt.NewWriter(&buf)
+	sourceDir = dir
+	var err error
+	if defaultACL, err = dumpfmt.ParseACL(aclStr); err != nil {
+		t.Fatal(err)
+	}
+	if err = dw.WriteSOD(dumpfmt.SOD{DumpFormatRevision: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if err = dumpDirContents(dw, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = dw.WriteEndOfDump(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLinkRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("CONTENTS"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "SUB"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../a.txt", filepath.Join(dir, "SUB", "LNK")); err != nil {
+		t.Fatal(err)
+	}
+	dump := bytes.NewReader(dumpTree(t, dir))
+	ix, err := dumpfmt.BuildIndex(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lnk, found := ix.Lookup("SUB/LNK"); !found || lnk.LinkTarget != "^A.TXT" {
+		t.Fatalf("Expected link SUB/LNK to ^A.TXT, got %+v", lnk)
+	}
+	data, err := fs.ReadFile(dumpfmt.NewFS(ix, dump), "SUB/LNK")
+	if err != nil || string(data) != "CONTENTS" {
+		t.Errorf("Expected the link to resolve to A.TXT, got %q, %v", data, err)
+	}
+}
+
+func TestSkipsDumpFile(t *testing.T) {
+	dir := t.TempDir()
+	dumpPath := filepath.Join(dir, "out.dmp")
+	if err := os.WriteFile(dumpPath, []byte("PARTIAL"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "keep.txt"), []byte("KEEP"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if dumpFileInfo, err = os.Stat(dumpPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { dumpFileInfo = nil }()
+	ix, err := dumpfmt.BuildIndex(bytes.NewReader(dumpTree(t, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := ix.Lookup("OUT.DMP"); found {
+		t.Error("The dump file was dumped into itself")
+	}
+	if _, found := ix.Lookup("KEEP.TXT"); !found {
+		t.Error("KEEP.TXT is missing from the dump")
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", maxNameLen)
+	hostNames := []string{"FOO", "a b", "a_b", "foo", long + "1", long + "2"}
+	for _, name := range hostNames {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dump := bytes.NewReader(dumpTree(t, dir))
+	ix, err := dumpfmt.BuildIndex(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := dumpfmt.NewFS(ix, dump)
+	// host names are dumped in sorted order, the later ones of each clash are renamed
+	expected := map[string]string{
+		"FOO":                            "FOO",
+		"A_B":                            "a b",
+		"A_B_1":                          "a_b",
+		"FOO_1":                          "foo",
+		strings.ToUpper(long):            long + "1",
+		strings.ToUpper(long[2:]) + "_1": long + "2",
+	}
+	for name, contents := range expected {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil || string(data) != contents {
+			t.Errorf("%s: expected %q, got %q, %v", name, contents, data, err)
+		}
+	}
+	if len(ix.Root.Children) != len(hostNames) {
+		t.Errorf("Expected %d entries, got %d", len(hostNames), len(ix.Root.Children))
+	}
+}
+
+func TestFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "prog.pr", "data.dat", "start.cli", "blob"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("X"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { typeMappings = typeMapFlag{} }()
+	for _, mapping := range []string{".dat=ftxt", "CLI=FUDF"} {
+		if err := typeMappings.Set(mapping); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rdr := dumpfmt.NewReader(bytes.NewReader(dumpTree(t, dir)))
+	types := map[string]string{}
+	var fstat dumpfmt.Fstat
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch r := rec.(type) {
+		case *dumpfmt.FSB:
+			fstat = r.Fstat
+		case *dumpfmt.NameBlock:
+			types[r.FileName] = dumpfmt.KnownFstatEntryTypes[fstat.EntryType].DgMnemonic
+		case *dumpfmt.ACL:
+			if acl := dumpfmt.FormatACL(r.Entries()); acl != "+,RE" {
+				t.Errorf("Expected the default ACL +,RE, got %s", acl)
+			}
+		}
+	}
+	want := map[string]string{"A.TXT": "FTXT", "PROG.PR": "FPRG", "DATA.DAT": "FTXT", "START.CLI": "FUDF", "BLOB": "FUDF"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("Expected types %v, got %v", want, types)
+	}
+}
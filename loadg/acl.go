@@ -0,0 +1,149 @@
+// acl.go - display and preservation of AOS/VS ACLs for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+const (
+	aclSidecarSuffix = ".aosvs.acl"
+	aclXattrName     = "user.aosvs.acl"
+)
+
+// ways in which ACLs may be preserved on extraction, set via the -acl option
+var aclSidecar, aclPerms, aclXattr bool
+
+func parseACLOpts(opts string) error {
+	if opts == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "sidecar":
+			aclSidecar = true
+		case "perms":
+			aclPerms = true
+		case "xattr":
+			aclXattr = true
+		default:
+			return fmt.Errorf("unknown ACL option <%s>, expected sidecar, perms and/or xattr", opt)
+		}
+	}
+	return nil
+}
+
+func processACL(acl *dumpfmt.ACL) {
+	entries := acl.Entries()
+	if catalogue != nil {
+		catalogue.setACL(entries)
+	}
+	if verbose || (list && entrySelected) {
+		fmt.Printf(" ACL: %s\n", dumpfmt.FormatACL(entries))
+	}
+	if arch != nil && archPending != nil {
+		archPending.acl = entries
+	}
+	if !extract || !entrySelected {
+		return
+	}
+	if aclSidecar {
+		var sb strings.Builder
+		for _, e := range entries {
+			sb.WriteString(e.String() + "\n")
+		}
+		if err := writeNewFile(entryPath+aclSidecarSuffix, []byte(sb.String())); err != nil {
+			log.Printf("ERROR: Could not write ACL file for %s due to %v", entryPath, err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+		}
+	}
+	// permissions and attributes are applied once the file or directory is complete
+	switch {
+	case entryIsDir && len(dirStack) > 0:
+		dirStack[len(dirStack)-1].acl = entries
+	case writing:
+		writeACL = entries
+	}
+}
+
+// applyACL sets the permissions and/or extended attribute of an extracted file or directory
+func applyACL(path string, entries []dumpfmt.ACLEntry, isDir, isProgram bool) {
+	if entries == nil {
+		return
+	}
+	if aclXattr {
+		if err := setXattr(path, aclXattrName, []byte(dumpfmt.FormatACL(entries))); err != nil {
+			log.Printf("ERROR: Could not set %s attribute on %s due to %v", aclXattrName, path, err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+		}
+	}
+	if aclPerms {
+		if err := os.Chmod(path, aclToMode(entries, isDir, isProgram)); err != nil {
+			log.Printf("ERROR: Could not set permissions of %s due to %v", path, err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+		}
+	}
+}
+
+// aclToMode maps an ACL onto POSIX permissions.
+// The owner gets the access of the first named (non "+") user, group and others get that of "+".
+// Execute access is only meaningful for directories and program files.
+func aclToMode(entries []dumpfmt.ACLEntry, isDir, isProgram bool) os.FileMode {
+	var owner, others byte
+	ownerFound := false
+	for _, e := range entries {
+		if e.UserPattern == "+" {
+			others = e.Access
+		} else if !ownerFound {
+			owner = e.Access
+			ownerFound = true
+		}
+	}
+	if !ownerFound {
+		owner = others
+	}
+	perms := func(access byte) os.FileMode {
+		var m os.FileMode
+		if access&dumpfmt.AccessRead != 0 {
+			m |= 4
+		}
+		if access&(dumpfmt.AccessWrite|dumpfmt.AccessAppend) != 0 {
+			m |= 2
+		}
+		if access&dumpfmt.AccessExecute != 0 && (isDir || isProgram) {
+			m |= 1
+		}
+		return m
+	}
+	return perms(owner)<<6 | perms(others)<<3 | perms(others)
+}
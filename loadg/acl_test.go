@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestACLToMode(t *testing.T) {
+	tests := []struct {
+		acl              string
+		isDir, isProgram bool
+		want             os.FileMode
+	}{
+		{"SMERRONY,OWARE +,RE", false, false, 0644},
+		{"SMERRONY,OWARE +,RE", false, true, 0755},
+		{"SMERRONY,OWARE +,RE", true, false, 0755},
+		{"+,RE", true, false, 0555},
+		{"+,WR", false, false, 0666},
+		{"+,A", false, false, 0222},
+		{"FRED,R JIM,OWARE +,", false, false, 0400}, // the first named user is the owner
+		{"+,R SMERRONY,WR", false, false, 0644},
+		{"", true, false, 0},
+	}
+	for _, tt := range tests {
+		entries, err := dumpfmt.ParseACL(tt.acl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := aclToMode(entries, tt.isDir, tt.isProgram); got != tt.want {
+			t.Errorf("%q (dir %v, program %v): expected %o, got %o", tt.acl, tt.isDir, tt.isProgram, tt.want, got)
+		}
+	}
+}
+
+func TestACLExtraction(t *testing.T) {
+	// the directory is read-only so its mode must be applied after its contents are extracted
+	dump := newDumpBuilder(t).
+		withACL("SMERRONY,RE +,RE").
+		dir("D").
+		withACL("SMERRONY,OWARE +,R").
+		file(64, "F", dataBlock{0, []byte("F")}).
+		end().
+		bytes()
+	aclSidecar, aclPerms = true, true
+	defer func() { aclSidecar, aclPerms = false, false }()
+	_, base := runLoadg(t, dump, true)
+	t.Cleanup(func() { os.Chmod(filepath.Join(base, "D"), 0755) })
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"D":                      "/",
+		"D" + aclSidecarSuffix:   "SMERRONY,RE\n+,RE\n",
+		"D/F":                    "F",
+		"D/F" + aclSidecarSuffix: "SMERRONY,OWARE\n+,R\n",
+	})
+	for name, want := range map[string]os.FileMode{"D": 0555, "D/F": 0644} {
+		info, err := os.Stat(filepath.Join(base, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: expected mode %o, got %o", name, want, info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// archive.go - conversion of dumps to tar and zip archives for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// zipExtraID identifies the zip extra field holding AOS/VS metadata, it is outside the
+// range reserved by PKWARE and holds "key=value" lines such as "user.aosvs.type=FTXT"
+const zipExtraID = 0x5641 // "AV"
+
+// PAX record keys for AOS/VS metadata, these are the keys GNU tar uses for extended
+// attributes so that `tar --xattrs` restores them as user.aosvs.type/acl/uda
+const (
+	paxTypeKey = "SCHILY.xattr.user.aosvs.type"
+	paxACLKey  = "SCHILY.xattr." + aclXattrName
+	paxUDAKey  = "SCHILY.xattr." + udaXattrName
+)
+
+// archiveEntry holds everything known about an entry before it is added to an archive
+type archiveEntry struct {
+	path  string // relative, '/'-separated
+	fstat dumpfmt.Fstat
+	isDir bool
+	acl   []dumpfmt.ACLEntry
+	uda   []byte
+}
+
+// archiver writes entries to an archive in the order they are found in the dump
+type archiver interface {
+	addDir(ae *archiveEntry) error
+	addLink(ae *archiveEntry, target string) error
+	// startFile returns the writer for the file's contents which are complete when endFile is called
+	startFile(ae *archiveEntry) (io.Writer, error)
+	endFile() error
+	close() error
+}
+
+var (
+	toTar, toZip   string
+	arch           archiver
+	archOut        io.WriteCloser
+	archPending    *archiveEntry // the current entry, not yet added to the archive
+	archPendingDir bool          // archPending is a directory not yet added
+)
+
+// openArchive prepares the -to-tar or -to-zip archive, "-" means the standard output
+func openArchive() error {
+	name := toTar
+	if toZip != "" {
+		name = toZip
+	}
+	if name == "-" {
+		archOut = os.Stdout
+	} else {
+		f, err := os.Create(name)
+		if err != nil {
+			return fmt.Errorf("could not create archive <%s> due to %v", name, err)
+		}
+		archOut = f
+	}
+	if toZip != "" {
+		arch = &zipArchiver{zw: zip.NewWriter(archOut)}
+	} else {
+		arch = &tarArchiver{tw: tar.NewWriter(archOut)}
+	}
+	return nil
+}
+
+func closeArchive() error {
+	if err := archFlushDir(); err != nil {
+		return err
+	}
+	if err := arch.close(); err != nil {
+		return err
+	}
+	if archOut == os.Stdout {
+		return nil
+	}
+	return archOut.Close()
+}
+
+// archNewEntry is called for every name block, entries not selected are not archived
+func archNewEntry(path string, fs dumpfmt.Fstat, isDir, selected bool) error {
+	if err := archFlushDir(); err != nil {
+		return err
+	}
+	if !selected {
+		archPending = nil
+		return nil
+	}
+	archPending = &archiveEntry{path: path, fstat: fs, isDir: isDir}
+	archPendingDir = isDir
+	return nil
+}
+
+func checkArchive(err error) {
+	if err != nil {
+		log.Fatalf("ERROR: Could not write archive due to %v", err)
+	}
+}
+
+// archFlushDir adds a pending directory now that its ACL and UDA have been seen
+func archFlushDir() error {
+	if !archPendingDir {
+		return nil
+	}
+	archPendingDir = false
+	return arch.addDir(archPending)
+}
+
+// archiveTime converts an AOS/VS time, archives must have some time so the epoch is used for unset times
+func archiveTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return hostTime(t)
+}
+
+func archiveMode(ae *archiveEntry) os.FileMode {
+	if aclPerms && ae.acl != nil {
+		return aclToMode(ae.acl, ae.isDir, isProgram(ae.fstat.EntryType))
+	}
+	if ae.isDir || isProgram(ae.fstat.EntryType) {
+		return 0755
+	}
+	return 0644
+}
+
+// metadata returns the AOS/VS metadata of the entry as key/value pairs
+func (ae *archiveEntry) metadata() map[string]string {
+	md := map[string]string{}
+	if et, known := dumpfmt.KnownFstatEntryTypes[ae.fstat.EntryType]; known {
+		md[paxTypeKey] = et.DgMnemonic
+	} else {
+		md[paxTypeKey] = fmt.Sprintf("%d", ae.fstat.EntryType)
+	}
+	if ae.acl != nil {
+		md[paxACLKey] = dumpfmt.FormatACL(ae.acl)
+	}
+	if ae.uda != nil {
+		md[paxUDAKey] = string(ae.uda)
+	}
+	return md
+}
+
+type tarArchiver struct {
+	tw    *tar.Writer
+	ae    *archiveEntry
+	spool *os.File
+}
+
+func (ta *tarArchiver) header(ae *archiveEntry, typeflag byte) *tar.Header {
+	hdr := &tar.Header{
+		Typeflag:   typeflag,
+		Name:       ae.path,
+		Mode:       int64(archiveMode(ae)),
+		ModTime:    archiveTime(ae.fstat.Modified),
+		AccessTime: archiveTime(ae.fstat.Accessed),
+		Format:     tar.FormatPAX,
+		PAXRecords: ae.metadata(),
+	}
+	if typeflag == tar.TypeDir {
+		hdr.Name += "/"
+	}
+	return hdr
+}
+
+func (ta *tarArchiver) addDir(ae *archiveEntry) error {
+	return ta.tw.WriteHeader(ta.header(ae, tar.TypeDir))
+}
+
+func (ta *tarArchiver) addLink(ae *archiveEntry, target string) error {
+	hdr := ta.header(ae, tar.TypeSymlink)
+	hdr.Linkname = target
+	return ta.tw.WriteHeader(hdr)
+}
+
+// startFile spools the contents as tar needs to know the size before they are written
+func (ta *tarArchiver) startFile(ae *archiveEntry) (io.Writer, error) {
+	var err error
+	ta.ae = ae
+	if ta.spool == nil {
+		if ta.spool, err = os.CreateTemp("", "loadg-spool-"); err != nil {
+			return nil, err
+		}
+	}
+	if err = ta.spool.Truncate(0); err != nil {
+		return nil, err
+	}
+	_, err = ta.spool.Seek(0, io.SeekStart)
+	return ta.spool, err
+}
+
+func (ta *tarArchiver) endFile() error {
+	size, err := ta.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	hdr := ta.header(ta.ae, tar.TypeReg)
+	hdr.Size = size
+	if err = ta.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err = ta.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.CopyN(ta.tw, ta.spool, size)
+	return err
+}
+
+func (ta *tarArchiver) close() error {
+	if ta.spool != nil {
+		ta.spool.Close()
+		os.Remove(ta.spool.Name())
+	}
+	return ta.tw.Close()
+}
+
+type zipArchiver struct {
+	zw *zip.Writer
+}
+
+func (za *zipArchiver) header(ae *archiveEntry) *zip.FileHeader {
+	fh := &zip.FileHeader{Name: ae.path, Method: zip.Deflate, Modified: archiveTime(ae.fstat.Modified)}
+	var sb strings.Builder
+	md := ae.metadata()
+	// the UDA is binary so is not included
+	for _, key := range []string{paxTypeKey, paxACLKey} {
+		if val, found := md[key]; found {
+			sb.WriteString(strings.TrimPrefix(key, "SCHILY.xattr.") + "=" + val + "\n")
+		}
+	}
+	extra := make([]byte, 4, 4+sb.Len())
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(sb.Len()))
+	fh.Extra = append(extra, sb.String()...)
+	return fh
+}
+
+func (za *zipArchiver) addDir(ae *archiveEntry) error {
+	fh := za.header(ae)
+	fh.Name += "/"
+	fh.Method = zip.Store
+	fh.SetMode(os.ModeDir | archiveMode(ae))
+	_, err := za.zw.CreateHeader(fh)
+	return err
+}
+
+func (za *zipArchiver) addLink(ae *archiveEntry, target string) error {
+	fh := za.header(ae)
+	fh.Method = zip.Store
+	fh.SetMode(os.ModeSymlink | 0777)
+	w, err := za.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (za *zipArchiver) startFile(ae *archiveEntry) (io.Writer, error) {
+	fh := za.header(ae)
+	fh.SetMode(archiveMode(ae))
+	return za.zw.CreateHeader(fh)
+}
+
+func (za *zipArchiver) endFile() error {
+	return nil
+}
+
+func (za *zipArchiver) close() error {
+	return za.zw.Close()
+}
@@ -0,0 +1,180 @@
+// catalogue.go - machine-readable listings of dump contents for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// catalogueEntry is one line of a machine-readable listing
+type catalogueEntry struct {
+	Path       string `json:"path"`
+	Type       string `json:"type"`
+	FstatType  int    `json:"fstatType"`
+	Size       int64  `json:"size"`
+	Created    string `json:"created,omitempty"`
+	Accessed   string `json:"accessed,omitempty"`
+	Modified   string `json:"modified,omitempty"`
+	ACL        string `json:"acl,omitempty"`
+	LinkTarget string `json:"linkTarget,omitempty"`
+	Offset     int64  `json:"offset"`
+}
+
+var catalogueHeadings = []string{"path", "type", "fstatType", "size", "created", "accessed", "modified", "acl", "linkTarget", "offset"}
+
+func (ce *catalogueEntry) fields() []string {
+	return []string{ce.Path, ce.Type, strconv.Itoa(ce.FstatType), strconv.FormatInt(ce.Size, 10),
+		ce.Created, ce.Accessed, ce.Modified, ce.ACL, ce.LinkTarget, strconv.FormatInt(ce.Offset, 10)}
+}
+
+// catalogueWriter emits each entry once all of its records have been seen,
+// ie. when the next entry begins or the dump ends.
+type catalogueWriter struct {
+	format  string
+	w       io.Writer
+	csvW    *csv.Writer
+	pending *catalogueEntry
+	count   int
+}
+
+func newCatalogueWriter(format string, w io.Writer) (*catalogueWriter, error) {
+	cw := &catalogueWriter{format: format, w: w}
+	switch format {
+	case "json":
+		fmt.Fprint(w, "[")
+	case "jsonl":
+	case "csv":
+		cw.csvW = csv.NewWriter(w)
+		if err := cw.csvW.Write(catalogueHeadings); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format <%s>, expected json, jsonl or csv", format)
+	}
+	return cw, nil
+}
+
+// start begins a new entry, writing out the previous one
+func (cw *catalogueWriter) start(path string, fsb *dumpfmt.FSB) error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	cw.pending = &catalogueEntry{
+		Path:      path,
+		FstatType: int(fsb.EntryType()),
+		Created:   catalogueTime(fsb.Fstat.Created),
+		Accessed:  catalogueTime(fsb.Fstat.Accessed),
+		Modified:  catalogueTime(fsb.Fstat.Modified),
+		Offset:    fsb.Offset,
+	}
+	if et, known := dumpfmt.KnownFstatEntryTypes[fsb.EntryType()]; known {
+		cw.pending.Type = et.DgMnemonic
+	} else {
+		cw.pending.Type = "UNKNOWN"
+	}
+	return nil
+}
+
+func (cw *catalogueWriter) setACL(entries []dumpfmt.ACLEntry) {
+	if cw.pending != nil {
+		cw.pending.ACL = dumpfmt.FormatACL(entries)
+	}
+}
+
+func (cw *catalogueWriter) setLinkTarget(target string) {
+	if cw.pending != nil {
+		cw.pending.LinkTarget = target
+	}
+}
+
+func (cw *catalogueWriter) setSize(size int) {
+	if cw.pending != nil {
+		cw.pending.Size = int64(size)
+	}
+}
+
+func (cw *catalogueWriter) flush() error {
+	if cw.pending == nil {
+		return nil
+	}
+	ce := cw.pending
+	cw.pending = nil
+	cw.count++
+	switch cw.format {
+	case "csv":
+		cw.csvW.Write(ce.fields())
+		cw.csvW.Flush()
+		return cw.csvW.Error()
+	default:
+		js, err := json.Marshal(ce)
+		if err != nil {
+			return err
+		}
+		if cw.format == "json" {
+			if cw.count > 1 {
+				fmt.Fprint(cw.w, ",")
+			}
+			fmt.Fprint(cw.w, "\n  ")
+		}
+		_, err = fmt.Fprintf(cw.w, "%s", js)
+		if cw.format == "jsonl" {
+			fmt.Fprintln(cw.w)
+		}
+		return err
+	}
+}
+
+// close writes out the final entry and terminates the listing
+func (cw *catalogueWriter) close() error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	if cw.format == "json" {
+		_, err := fmt.Fprint(cw.w, "\n]\n")
+		return err
+	}
+	return nil
+}
+
+// catalogueTime formats an AOS/VS time, which has no zone, as ISO 8601
+func catalogueTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+// cataloguePath returns the path of an entry relative to the base directory using '/' separators
+func cataloguePath(path string) string {
+	if rel, err := filepath.Rel(baseDir, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCatalogue(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("UDD").
+		file(68, `A,B "Q"`, dataBlock{0, []byte("HELLO")}).
+		link("L", `A,B "Q"`).
+		end().
+		file(64, "SKIP.OB", dataBlock{0, []byte("SKIPPED")}).
+		file(64, "LAST", dataBlock{0, []byte("OK")}).
+		bytes()
+	want := []catalogueEntry{
+		{Path: "UDD", Type: "FDIR", FstatType: 10, ACL: "+,R"},
+		{Path: `UDD/A,B "Q"`, Type: "FTXT", FstatType: 68, Size: 5, ACL: "+,R"},
+		{Path: "UDD/L", Type: "FLNK", ACL: "+,R", LinkTarget: `A,B "Q"`},
+		{Path: "LAST", Type: "FUDF", FstatType: 64, Size: 2, ACL: "+,R"},
+	}
+	tests := []struct {
+		format string
+		raw    string // expected somewhere in the output
+		parse  func(string) ([]catalogueEntry, error)
+	}{
+		{"json", "[\n  {", func(out string) (entries []catalogueEntry, err error) {
+			err = json.Unmarshal([]byte(out), &entries)
+			return entries, err
+		}},
+		{"jsonl", `"path":"UDD/L"`, func(out string) (entries []catalogueEntry, err error) {
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+				var ce catalogueEntry
+				if err = json.Unmarshal([]byte(line), &ce); err != nil {
+					return nil, err
+				}
+				entries = append(entries, ce)
+			}
+			return entries, nil
+		}},
+		{"csv", `"UDD/A,B ""Q""",FTXT,68,5,`, func(out string) (entries []catalogueEntry, err error) {
+			rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(rows[0], catalogueHeadings) {
+				t.Errorf("Unexpected CSV headings %v", rows[0])
+			}
+			for _, row := range rows[1:] {
+				ce := catalogueEntry{Path: row[0], Type: row[1], Created: row[4], Accessed: row[5], Modified: row[6], ACL: row[7], LinkTarget: row[8]}
+				ce.FstatType, _ = strconv.Atoi(row[2])
+				ce.Size, _ = strconv.ParseInt(row[3], 10, 64)
+				ce.Offset, _ = strconv.ParseInt(row[9], 10, 64)
+				entries = append(entries, ce)
+			}
+			return entries, nil
+		}},
+	}
+	includes, excludes = nil, nil
+	excludes.Set("+.OB")
+	defer func() { includes, excludes, catalogue = nil, nil, nil }()
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		var err error
+		if catalogue, err = newCatalogueWriter(tt.format, &buf); err != nil {
+			t.Fatal(err)
+		}
+		runLoadg(t, dump, false)
+		out := buf.String()
+		if !strings.Contains(out, tt.raw) {
+			t.Errorf("%s: expected %q in:\n%s", tt.format, tt.raw, out)
+		}
+		got, err := tt.parse(out)
+		if err != nil {
+			t.Errorf("%s: could not parse output due to %v:\n%s", tt.format, err, out)
+			continue
+		}
+		var lastOffset int64
+		for i := range got {
+			if got[i].Offset <= lastOffset {
+				t.Errorf("%s: offset of %s is %d, after %d", tt.format, got[i].Path, got[i].Offset, lastOffset)
+			}
+			lastOffset, got[i].Offset = got[i].Offset, 0
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", tt.format, want, got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// compress.go - reading of compressed dumps for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// stdinName is the -dumpFile name meaning the standard input
+const stdinName = "-"
+
+// the magic numbers at the start of compressed files
+var compressionMagic = []struct {
+	name  string
+	ext   string
+	magic []byte
+}{
+	{"gzip", ".gz", []byte{0x1f, 0x8b}},
+	{"bzip2", ".bz2", []byte("BZh")},
+	{"xz", ".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", ".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+const maxMagicLen = 6
+
+// compression returns the name of the compression used for data beginning with magic, or "" if none is recognised
+func compression(magic []byte) string {
+	for _, cm := range compressionMagic {
+		if bytes.HasPrefix(magic, cm.magic) {
+			return cm.name
+		}
+	}
+	return ""
+}
+
+// trimCompressionExt removes any compression extension from the name, eg. for BACKUP.TAP.GZ
+func trimCompressionExt(name string) string {
+	ext := filepath.Ext(name)
+	for _, cm := range compressionMagic {
+		if strings.EqualFold(ext, cm.ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// openDump opens a dump that is a single file, which may be compressed, "-" meaning stdin
+func openDump(name string) (io.Reader, error) {
+	var in io.Reader = os.Stdin
+	if name != stdinName {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open dump file <%s> due to %v", name, err)
+		}
+		in = f
+	}
+	r, kind, err := decompress(in)
+	if err != nil {
+		return nil, fmt.Errorf("could not read dump file <%s> due to %v", name, err)
+	}
+	if verbose && kind != "" {
+		fmt.Printf("Decompressing %s dump\n", kind)
+	}
+	return r, nil
+}
+
+// seekable reports whether r can really seek, which the standard input may not
+func seekable(r io.Reader) bool {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := s.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+// decompress returns a reader of the uncompressed dump and the compression detected.
+// Seekable input that is not compressed is returned unchanged.
+func decompress(r io.Reader) (io.Reader, string, error) {
+	var magic []byte
+	if seekable(r) {
+		rs := r.(io.ReadSeeker)
+		start, _ := rs.Seek(0, io.SeekCurrent)
+		magic = make([]byte, maxMagicLen)
+		n, _ := io.ReadFull(rs, magic)
+		magic = magic[:n]
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, "", err
+		}
+	} else {
+		br := bufio.NewReader(r)
+		magic, _ = br.Peek(maxMagicLen)
+		r = br
+	}
+	kind := compression(magic)
+	var err error
+	switch kind {
+	case "":
+		return r, "", nil
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "bzip2":
+		r = bzip2.NewReader(r)
+	case "xz":
+		r, err = xz.NewReader(r)
+	case "zstd":
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(r); err == nil {
+			r = zr.IOReadCloser()
+		}
+	}
+	return r, kind, err
+}
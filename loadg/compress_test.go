@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestDecompress(t *testing.T) {
+	dump := sampleDump(t)
+	compressors := map[string]func(w io.Writer) (io.WriteCloser, error){
+		"gzip": func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		"xz":   func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) },
+		"zstd": func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+	}
+	for kind, newWriter := range compressors {
+		var buf bytes.Buffer
+		cw, err := newWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cw.Write(dump)
+		cw.Close()
+		r, gotKind, err := decompress(&buf)
+		if err != nil || gotKind != kind {
+			t.Errorf("%s: detected <%s>, error %v", kind, gotKind, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, dump) {
+			t.Errorf("%s: decompressed dump differs, error %v", kind, err)
+		}
+	}
+
+	plain := bytes.NewReader(dump)
+	plain.Seek(10, io.SeekStart)
+	r, kind, err := decompress(plain)
+	if err != nil || kind != "" || r != io.Reader(plain) {
+		t.Errorf("Expected an uncompressed seekable dump to be returned unchanged, got <%s> %v", kind, err)
+	}
+	if pos, _ := plain.Seek(0, io.SeekCurrent); pos != 10 {
+		t.Errorf("Expected the dump to be left at offset 10, got %d", pos)
+	}
+
+	if trimCompressionExt("BACKUP.TAP.GZ") != "BACKUP.TAP" || trimCompressionExt("BACKUP.DMP") != "BACKUP.DMP" {
+		t.Error("Compression extension not trimmed correctly")
+	}
+}
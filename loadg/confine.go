@@ -0,0 +1,127 @@
+// confine.go - keeping extraction from untrusted dumps within the base directory for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// safeName makes a host name that is a single path component, escaping any separators and NULs
+// and names such as ".." which would refer to another directory
+func safeName(name string) string {
+	switch name {
+	case "":
+		return escapeByte(0)
+	case ".", "..":
+		return strings.Repeat(escapeByte('.'), len(name))
+	}
+	var sb strings.Builder
+	for _, c := range []byte(name) {
+		if c == '/' || c == os.PathSeparator || c == 0 {
+			sb.WriteString(escapeByte(c))
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// within reports whether the host path p is root or below it
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// checkNoSymlinks returns an error if any existing directory from root down to dir is a symbolic
+// link, which could lead outside root
+func checkNoSymlinks(root, dir string) error {
+	if !within(root, dir) {
+		return fmt.Errorf("<%s> is outside <%s>", dir, root)
+	}
+	rel, _ := filepath.Rel(root, dir)
+	p := root
+	for _, elem := range strings.Split(rel, string(os.PathSeparator)) {
+		if elem == "." {
+			continue
+		}
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("<%s> is a symbolic link", p)
+		}
+	}
+	return nil
+}
+
+// createFile creates a new file, replacing any existing file or symbolic link, without following links.
+// The directory containing it must not be reached through a symbolic link, even if creating that directory
+// was only reported as an error.
+func createFile(name string) (*os.File, error) {
+	if err := checkNoSymlinks(baseDir, filepath.Dir(name)); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(name); err == nil && !info.IsDir() {
+		if err = os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	// O_EXCL also refuses to follow a link created in the meantime
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// writeNewFile is os.WriteFile using createFile
+func writeNewFile(name string, data []byte) error {
+	f, err := createFile(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// relativeLinkTarget resolves the AOS/VS target of the link at linkPath, which is relative to the top of the
+// extraction or archive and uses '/' separators.  ':' is the top, '^' the parent directory and each name is
+// mapped as extracted names are.  It returns the target relative to the directory containing the link, or an
+// error if it would lead outside the top.
+func relativeLinkTarget(linkPath, target string) (string, error) {
+	dir := path.Dir(linkPath)
+	resolved, ok := dumpfmt.ResolveLink(dir, target, hostLinkName)
+	if !ok {
+		return "", fmt.Errorf("link %s to %s, it leads outside the top directory", linkPath, target)
+	}
+	return dumpfmt.RelativePath(dir, resolved), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestConfinement(t *testing.T) {
+	dump := newDumpBuilder(t).
+		file(64, "../EVIL", dataBlock{0, []byte("OUT")}).
+		dir("..").
+		file(64, "X", dataBlock{0, []byte("IN")}).
+		end().
+		link("UP", "..:..:ETC:PASSWD").
+		bytes()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"..%2FEVIL": "OUT",
+		"%2E%2E":    "/",
+		"%2E%2E/X":  "IN",
+		"UP":        "->%2E%2E/%2E%2E/ETC/PASSWD",
+	})
+
+	// link targets are resolved, with ':' at the top of the extraction, before being confined to it
+	dump = newDumpBuilder(t).
+		file(68, "T", dataBlock{0, []byte("TOP\n")}).
+		dir("D").
+		link("ROOTED", ":T").
+		link("UP", dumpfmt.FormatPathname(false, []string{"^", "T"})).
+		link("ESCAPE", "^^ETC:PASSWD").
+		link("ROOTUP", ":^ETC:PASSWD").
+		end().
+		bytes()
+	ignoreErrors = true
+	defer func() { ignoreErrors = false }()
+	_, base = runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"T":        "TOP\n",
+		"D":        "/",
+		"D/ROOTED": "->../T",
+		"D/UP":     "->../T",
+	})
+	for _, lnk := range []string{"D/ROOTED", "D/UP"} {
+		if data, err := os.ReadFile(filepath.Join(base, lnk)); err != nil || string(data) != "TOP\n" {
+			t.Errorf("Expected %s to lead to T, got %q, %v", lnk, data, err)
+		}
+	}
+	ignoreErrors = false
+
+	// links already in the extraction directory must not be followed
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "VICTIM")
+	if err := os.WriteFile(victim, []byte("SAFE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dump = newDumpBuilder(t).file(64, "F", dataBlock{0, []byte("NEW")}).bytes()
+	runLoader(t, true, func() {
+		if err := os.Symlink(victim, "F"); err != nil {
+			t.Fatal(err)
+		}
+		loadDump(bytes.NewReader(dump), "TEST.DMP")
+		if data, _ := os.ReadFile("F"); string(data) != "NEW" {
+			t.Errorf("Expected the link to be replaced by the extracted file, got %q", data)
+		}
+	})
+	if data, _ := os.ReadFile(victim); string(data) != "SAFE" {
+		t.Errorf("File outside the extraction directory was overwritten with %q", data)
+	}
+	if err := checkNoSymlinks(base, filepath.Join(base, "D", "UP", "X")); err == nil {
+		t.Error("Expected a directory path through a symbolic link to be refused")
+	}
+	if _, err := relativeLinkTarget("D/L", "^^X"); err == nil {
+		t.Error("Expected a link leading outside the top directory to be refused")
+	}
+	if target, err := relativeLinkTarget("D/E/L", ":D:X"); err != nil || target != "../X" {
+		t.Errorf("Expected an absolute link to be made relative to its directory, got %s, %v", target, err)
+	}
+	if target, err := relativeLinkTarget("D/L", "../../X"); err != nil || target != "..%2F..%2FX" {
+		t.Errorf("Expected host separators in a link target to be escaped, got %s, %v", target, err)
+	}
+}
+
+func TestRefusedDirectory(t *testing.T) {
+	// nothing may be written below a directory refused for being a link, even with -i
+	outside := t.TempDir()
+	dump := newDumpBuilder(t).
+		dir("VICTIM").
+		file(68, "PASSWD", dataBlock{0, []byte("EVIL\n")}).
+		link("LNK", "PASSWD").
+		dir("SUB").
+		file(68, "F", dataBlock{0, []byte("EVIL\n")}).
+		end().
+		end().
+		bytes()
+	ignoreErrors, aclSidecar, udaSidecar = true, true, true
+	defer func() { ignoreErrors, aclSidecar, udaSidecar = false, false, false }()
+	runLoader(t, true, func() {
+		if err := os.Symlink(outside, "VICTIM"); err != nil {
+			t.Fatal(err)
+		}
+		loadDump(bytes.NewReader(dump), "TEST.DMP")
+	})
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written through the link, found %v", entries)
+	}
+}
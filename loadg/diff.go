@@ -0,0 +1,291 @@
+// diff.go - comparison of dumps with each other or with extracted trees for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// diffEntry is what is compared of each entry of a dump or host tree
+type diffEntry struct {
+	class    string // "directory", "file" or "link"
+	dgType   string // DG mnemonic, unknown for host trees
+	size     int64
+	modified time.Time // zero if unknown
+	acl      string
+	hasACL   bool
+	hash     string // SHA-256 of the contents of files
+	link     string // target relative to the top of the dump or tree
+	partial  bool   // a host file that was only partially recovered
+}
+
+// snapshot maps the '/'-separated path of each entry to its description
+type snapshot map[string]*diffEntry
+
+// linkPath returns the target of an AOS/VS link relative to the top of the dump, as extraction would create it,
+// or the target as dumped if it leads outside the dump
+func linkPath(dir, target string) string {
+	if resolved, ok := dumpfmt.ResolveLink(dir, target, dumpfmt.IndexName); ok {
+		return resolved
+	}
+	return target
+}
+
+// dumpSnapshot reads a whole dump describing each selected entry
+func dumpSnapshot(r io.Reader) (snapshot, error) {
+	rdr := dumpfmt.NewReader(r)
+	if _, err := rdr.Next(); err != nil {
+		return nil, err
+	}
+	snap := snapshot{}
+	dirs := []string{"."}
+	var fstat dumpfmt.Fstat
+	entry := &diffEntry{}
+	h := sha256.New()
+	inFile := false
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			return snap, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch r := rec.(type) {
+		case *dumpfmt.FSB:
+			fstat = r.Fstat
+		case *dumpfmt.NameBlock:
+			entryPath := path.Join(dirs[len(dirs)-1], strings.ToUpper(r.FileName))
+			entry = &diffEntry{class: "file", dgType: fmt.Sprintf("%d", fstat.EntryType), modified: fstat.Modified}
+			et, known := dumpfmt.KnownFstatEntryTypes[fstat.EntryType]
+			if known {
+				entry.dgType = et.DgMnemonic
+			}
+			switch {
+			case known && et.IsDir:
+				entry.class = "directory"
+				dirs = append(dirs, entryPath)
+			case known && et.DgMnemonic == "FLNK":
+				entry.class = "link"
+			}
+			if !selected(entryPath) {
+				entry = &diffEntry{} // described but not compared
+			} else {
+				snap[entryPath] = entry
+			}
+		case *dumpfmt.ACL:
+			entry.acl, entry.hasACL = dumpfmt.FormatACL(r.Entries()), true
+		case *dumpfmt.Link:
+			entry.link = linkPath(dirs[len(dirs)-1], r.LinkResolutionName)
+		case *dumpfmt.StartBlock:
+			inFile = true
+			h = sha256.New()
+		case *dumpfmt.DataBlock:
+			if int64(r.ByteAddress) > entry.size {
+				writeZeros(h, int64(r.ByteAddress)-entry.size)
+				entry.size = int64(r.ByteAddress)
+			}
+			h.Write(r.Data)
+			entry.size += int64(r.ByteLength)
+		case *dumpfmt.EndBlock:
+			if inFile {
+				entry.hash = hex.EncodeToString(h.Sum(nil))
+				inFile = false
+			} else if len(dirs) > 1 { // dumps may contain 'too many' pops
+				dirs = dirs[:len(dirs)-1]
+			}
+		case *dumpfmt.EndOfDump:
+			return snap, nil
+		}
+	}
+}
+
+// treeSnapshot describes each selected entry of a tree extracted by loadg, taking
+// ACLs from any sidecar files and noting files that were only partially recovered
+func treeSnapshot(root string) (snapshot, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	snap := snapshot{}
+	err = filepath.WalkDir(root, func(hostPath string, d fs.DirEntry, err error) error {
+		if err != nil || hostPath == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, hostPath)
+		if err != nil {
+			return err
+		}
+		relPath := filepath.ToSlash(rel)
+		if strings.HasSuffix(relPath, aclSidecarSuffix) || strings.HasSuffix(relPath, udaSidecarSuffix) {
+			return nil
+		}
+		partial := strings.HasSuffix(relPath, partialSuffix)
+		relPath = strings.TrimSuffix(relPath, partialSuffix)
+		if !selected(relPath) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := &diffEntry{class: "file", modified: info.ModTime(), partial: partial}
+		switch {
+		case d.IsDir():
+			entry.class = "directory"
+		case d.Type()&fs.ModeSymlink != 0:
+			entry.class = "link"
+			target, err := os.Readlink(hostPath)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(hostPath), target)
+			}
+			if target, err = filepath.Rel(root, target); err != nil {
+				return err
+			}
+			entry.link = filepath.ToSlash(target)
+		default:
+			f, err := os.Open(hostPath)
+			if err != nil {
+				return err
+			}
+			h := sha256.New()
+			entry.size, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			entry.hash = hex.EncodeToString(h.Sum(nil))
+		}
+		if acl, err := os.ReadFile(strings.TrimSuffix(hostPath, partialSuffix) + aclSidecarSuffix); err == nil {
+			entry.acl, entry.hasACL = strings.Join(strings.Fields(string(acl)), " "), true
+		}
+		snap[relPath] = entry
+		return nil
+	})
+	return snap, err
+}
+
+// differences describes how entry b differs from entry a, empty if they are the same
+func differences(a, b *diffEntry, hostTree bool) []string {
+	const timeFmt = "2006-01-02 15:04:05"
+	var diffs []string
+	if a.class != b.class {
+		return []string{fmt.Sprintf("%s -> %s", a.class, b.class)}
+	}
+	if !hostTree && a.dgType != b.dgType {
+		diffs = append(diffs, fmt.Sprintf("type %s -> %s", a.dgType, b.dgType))
+	}
+	if b.partial {
+		diffs = append(diffs, "partially recovered")
+	}
+	if a.size != b.size {
+		diffs = append(diffs, fmt.Sprintf("size %d -> %d", a.size, b.size))
+	}
+	if a.hash != b.hash {
+		diffs = append(diffs, "contents")
+	}
+	switch {
+	case a.class == "link" || a.modified.IsZero():
+		// extraction does not set the times of links or of entries without them
+	case hostTree && !hostTime(a.modified).Equal(b.modified.Truncate(time.Second)):
+		diffs = append(diffs, fmt.Sprintf("modified %s -> %s", a.modified.Format(timeFmt), b.modified.Format(timeFmt)))
+	case !hostTree && !a.modified.Equal(b.modified):
+		diffs = append(diffs, fmt.Sprintf("modified %s -> %s", a.modified.Format(timeFmt), b.modified.Format(timeFmt)))
+	}
+	if a.hasACL && b.hasACL && a.acl != b.acl {
+		diffs = append(diffs, fmt.Sprintf("ACL %s -> %s", a.acl, b.acl))
+	}
+	if a.link != b.link {
+		diffs = append(diffs, fmt.Sprintf("link target %s -> %s", a.link, b.link))
+	}
+	return diffs
+}
+
+// diffDumps reports the entries added, removed and changed between dump a and either dump b or
+// a tree extracted to directory b, it returns false if there are any differences
+func diffDumps(a, b string) (bool, error) {
+	r, err := openDump(a)
+	if err != nil {
+		return false, err
+	}
+	before, err := dumpSnapshot(r)
+	if err != nil {
+		return false, fmt.Errorf("could not read dump <%s> due to %v", a, err)
+	}
+	var after snapshot
+	info, err := os.Stat(b)
+	hostTree := err == nil && info.IsDir()
+	if hostTree {
+		after, err = treeSnapshot(b)
+	} else if r, err = openDump(b); err == nil {
+		after, err = dumpSnapshot(r)
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read <%s> due to %v", b, err)
+	}
+
+	var paths []string
+	for p := range before {
+		paths = append(paths, p)
+	}
+	for p := range after {
+		if _, found := before[p]; !found {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var added, removed, changed int
+	for _, p := range paths {
+		was, wasFound := before[p]
+		now, nowFound := after[p]
+		switch {
+		case !nowFound:
+			fmt.Printf("- %s\n", p)
+			removed++
+		case !wasFound:
+			fmt.Printf("+ %s\n", p)
+			added++
+		default:
+			if diffs := differences(was, now, hostTree); len(diffs) > 0 {
+				fmt.Printf("~ %s: %s\n", p, strings.Join(diffs, ", "))
+				changed++
+			}
+		}
+	}
+	fmt.Printf("%d added, %d removed, %d changed\n", added, removed, changed)
+	return added+removed+changed == 0, nil
+}
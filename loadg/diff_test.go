@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	dumpA, dumpB := filepath.Join(dir, "A.DMP"), filepath.Join(dir, "B.DMP")
+	if err := os.WriteFile(dumpA, sampleDump(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := newDumpBuilder(t).
+		dir("UDD").
+		dir("src").
+		file(68, "hello.txt", dataBlock{0, []byte("HELLO\nTHERE\n")}).
+		file(64, "SPARSE", dataBlock{0, bytes.Repeat([]byte{'A'}, 512)}, dataBlock{2048, []byte("END")}).
+		file(64, "EMPTY").
+		file(64, "NEW").
+		end().
+		link("HELLO", "UDD:SRC:HELLO.TXT").
+		end().
+		file(87, "TOP.PR", dataBlock{0, []byte("PROG")}).
+		file(64, "LAST.CLI", dataBlock{0, []byte("WRITE DONE\n")}).
+		bytes()
+	if err := os.WriteFile(dumpB, changed, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var same bool
+	var err error
+	out, _ := runLoader(t, false, func() { same, err = diffDumps(dumpA, dumpB) })
+	want := "~ LAST.CLI: type FTXT -> FUDF\n" +
+		"- UDD/MYSTERY\n" +
+		"~ UDD/SRC/HELLO.TXT: contents\n" +
+		"+ UDD/SRC/NEW\n" +
+		"1 added, 1 removed, 2 changed\n"
+	if err != nil || same || out != want {
+		t.Errorf("Dump comparison mismatch, error %v\nexpected:\n%s\ngot:\n%s", err, want, out)
+	}
+
+	// against a tree extracted from the first dump
+	_, tree := runLoadg(t, sampleDump(t), true)
+	if err = os.Remove(filepath.Join(tree, "UDD", "SRC", "EMPTY")); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = runLoader(t, false, func() { same, err = diffDumps(dumpA, tree) })
+	want = "- UDD/SRC/EMPTY\n0 added, 1 removed, 0 changed\n"
+	if err != nil || same || out != want {
+		t.Errorf("Tree comparison mismatch, error %v\nexpected:\n%s\ngot:\n%s", err, want, out)
+	}
+}
+
+func TestDiffLinks(t *testing.T) {
+	// the same targets written differently
+	build := func(rooted, parent string) []byte {
+		return newDumpBuilder(t).
+			dir("UDD").
+			file(68, "X", dataBlock{0, []byte("X\n")}).
+			link("ROOTED", rooted).
+			link("PARENT", parent).
+			end().
+			file(68, "TOP", dataBlock{0, []byte("TOP\n")}).
+			bytes()
+	}
+	dir := t.TempDir()
+	dumpA, dumpB := filepath.Join(dir, "A.DMP"), filepath.Join(dir, "B.DMP")
+	if err := os.WriteFile(dumpA, build(":UDD:X", "^TOP"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dumpB, build("x", "^:top"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, tree := runLoadg(t, build(":UDD:X", "^TOP"), true)
+	for _, other := range []string{dumpB, tree} {
+		var same bool
+		var err error
+		out, _ := runLoader(t, false, func() { same, err = diffDumps(dumpA, other) })
+		if err != nil || !same {
+			t.Errorf("Expected the links of %s to match, error %v, got:\n%s", other, err, out)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// index.go - sidecar indexes for quick access to large dumps in loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// indexSuffix is appended to the dump file name to give the name of its sidecar index
+const indexSuffix = ".idx"
+
+var useIndex bool
+
+// openIndex loads the sidecar index of the dump, first building it if it is missing or out of date
+func openIndex(dumpFile *os.File) (*dumpfmt.Index, error) {
+	dumpInfo, err := dumpFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	indexName := dumpFile.Name() + indexSuffix
+	if indexInfo, err := os.Stat(indexName); err == nil && !indexInfo.ModTime().Before(dumpInfo.ModTime()) {
+		indexFile, err := os.Open(indexName)
+		if err != nil {
+			return nil, err
+		}
+		defer indexFile.Close()
+		ix, err := dumpfmt.ReadIndex(indexFile)
+		if err == nil && ix.DumpSize == dumpInfo.Size() {
+			if verbose {
+				fmt.Printf("Using index %s\n", indexName)
+			}
+			return ix, nil
+		}
+	}
+	if verbose {
+		fmt.Printf("Building index %s\n", indexName)
+	}
+	ix, err := dumpfmt.BuildIndex(dumpFile)
+	if err != nil {
+		return nil, err
+	}
+	indexFile, err := os.Create(indexName)
+	if err != nil {
+		return nil, fmt.Errorf("could not create index <%s> due to %v", indexName, err)
+	}
+	if err = ix.Write(indexFile); err != nil {
+		indexFile.Close()
+		return nil, fmt.Errorf("could not write index <%s> due to %v", indexName, err)
+	}
+	return ix, indexFile.Close()
+}
+
+// loadIndexed lists and/or extracts the dump via its index by replaying the records of the selected entries,
+// so that the data of unselected files is never read
+func loadIndexed(ix *dumpfmt.Index, dump io.ReaderAt, dumpName string) {
+	baseDir, _ = os.Getwd()
+	workingDir = baseDir
+	resetHostNames()
+	sod := ix.SOD
+	showSOD(&sod, dumpName)
+	for _, e := range ix.Root.Children {
+		replayEntry(e, dump)
+	}
+	processRecord(&dumpfmt.EndOfDump{RecordHeader: dumpfmt.RecordHeader{RecordType: dumpfmt.EndDumpType}})
+}
+
+// wanted reports whether the entry, or anything within it, is selected
+func wanted(e *dumpfmt.IndexEntry) bool {
+	if selected(e.Path) {
+		return true
+	}
+	for _, c := range e.Children {
+		if wanted(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func replayEntry(e *dumpfmt.IndexEntry, dump io.ReaderAt) {
+	if !wanted(e) {
+		return
+	}
+	hdr := func(recType int) dumpfmt.RecordHeader {
+		return dumpfmt.RecordHeader{RecordType: recType}
+	}
+	processRecord(&dumpfmt.FSB{RecordHeader: dumpfmt.RecordHeader{RecordType: dumpfmt.FSBType, Offset: e.Offset},
+		Blob: dumpfmt.EncodeFstat(e.Fstat), Fstat: e.Fstat})
+	processRecord(&dumpfmt.NameBlock{RecordHeader: hdr(dumpfmt.NameBlockType), FileName: e.Name})
+	if e.UDA != nil {
+		processRecord(&dumpfmt.UDA{RecordHeader: hdr(dumpfmt.UDAType), UDA: e.UDA})
+	}
+	if e.ACL != nil {
+		processRecord(&dumpfmt.ACL{RecordHeader: hdr(dumpfmt.ACLType), ACL: dumpfmt.EncodeACL(e.ACL)})
+	}
+	switch {
+	case e.IsLink():
+		processRecord(&dumpfmt.Link{RecordHeader: hdr(dumpfmt.LinkType), LinkResolutionName: e.LinkTarget})
+		return
+	case e.IsDir():
+		for _, c := range e.Children {
+			replayEntry(c, dump)
+		}
+	default:
+		processRecord(&dumpfmt.StartBlock{RecordHeader: hdr(dumpfmt.StartBlockType)})
+		for _, ext := range e.Extents {
+			db := &dumpfmt.DataBlock{RecordHeader: hdr(dumpfmt.DataBlockType),
+				ByteAddress: dumpfmt.DwordT(ext.Address), ByteLength: dumpfmt.DwordT(ext.Length)}
+			// only the sizes are needed unless the file is being written or hashed
+			if writing || fileHashes != nil {
+				db.Data = make([]byte, ext.Length)
+				if _, err := dump.ReadAt(db.Data, ext.DumpOffset); err != nil {
+					log.Fatalf("ERROR: Could not read data of %s due to %v", e.Path, err)
+				}
+			}
+			processRecord(db)
+		}
+	}
+	processRecord(&dumpfmt.EndBlock{RecordHeader: hdr(dumpfmt.EndBlockType)})
+}
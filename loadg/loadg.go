@@ -22,191 +22,438 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
 )
 
-const semVer = "v1.4.1"
+const semVer = "v1.19.0"
 
 // program flags (options)...
 var (
-	extract, ignoreErrors, list, summary, verbose, version bool
-	dump                                                   string
+	extract, ignoreErrors, list, noTimes, summary, verbose, version bool
+	aclOpts, dump, format, udaOpts                                  string
 )
 
 var (
-	fsbBlob                       []byte
-	inFile, loadIt                bool
+	fsb                           *dumpfmt.FSB
+	inFile, loadIt, writing       bool
+	entrySelected                 bool
 	totalFileSize                 int
 	baseDir, fileName, workingDir string
 	writeFile                     *os.File
+	dataOut                       io.Writer // where the data of the current file goes, writeFile or an archive
+	catalogue                     *catalogueWriter
+	writePath                     string
+	writeFstat                    dumpfmt.Fstat
+	writeACL                      []dumpfmt.ACLEntry
+	entryPath                     string // full path of the current entry
+	entryDumpPath                 string // '/'-separated path of the current entry within the dump
+	entryIsDir                    bool
+	dirStack                      []dirEntry // directories entered, innermost last
 )
 
+// dirEntry records a directory created during extraction so that its times may be set once its contents are loaded
+type dirEntry struct {
+	path      string
+	dumpPath  string
+	name      string // as dumped
+	aosvsPath string // ':'-separated path of the directory in the dump, with names as dumped
+	fstat     dumpfmt.Fstat
+	acl       []dumpfmt.ACLEntry
+	// the directory may not be created if none of its contents are selected
+	created    bool
+	registered bool // its host name is taken once anything within it is selected
+}
+
 func init() {
-	flag.StringVar(&dump, "dumpFile", "", "DUMP_II or DUMP_III file to read/load")
-	flag.StringVar(&dump, "d", "", "DUMP_II or DUMP_III file to read/load")
+	flag.StringVar(&aclOpts, "acl", "", "preserve ACLs of extracted files as comma-separated list of: sidecar,perms,xattr")
+	flag.StringVar(&dump, "dumpFile", "", "DUMP_II or DUMP_III file to read/load (may be compressed, - for stdin), or a glob matching all its volumes")
+	flag.StringVar(&dump, "d", "", "DUMP_II or DUMP_III file to read/load (may be compressed, - for stdin), or a glob matching all its volumes")
 	flag.BoolVar(&extract, "extract", false, "extract the files from the DUMP_II/III into the current directory")
 	flag.BoolVar(&extract, "e", false, "extract the files from the DUMP_II/III into the current directory")
+	flag.StringVar(&format, "format", "", "list the contents in a machine-readable format: json, jsonl or csv")
+	flag.StringVar(&toTar, "to-tar", "", "extract the files into a tar archive rather than the current directory, - for stdout")
+	flag.StringVar(&toZip, "to-zip", "", "extract the files into a zip archive rather than the current directory, - for stdout")
+	flag.StringVar(&hashOpts, "hash", "", "show digests of the file contents as comma-separated list of: sha256,md5")
+	flag.Var(&includes, "include", "only list/extract entries matching this AOS/VS template or glob (may be repeated)")
+	flag.Var(&excludes, "exclude", "do not list/extract entries matching this AOS/VS template or glob (may be repeated)")
+	flag.BoolVar(&useIndex, "index", false, "use the sidecar index <dumpfile>.idx, building it first if necessary")
 	flag.BoolVar(&ignoreErrors, "ignoreErrors", false, "do not exit if a file cannot be created")
 	flag.BoolVar(&ignoreErrors, "i", false, "do not exit if a file cannot be created")
+	flag.StringVar(&recordsFormat, "records", "", "write the records of extracted files as: text, jsonl or binary (length-prefixed)")
+	flag.BoolVar(&recoverDamage, "recover", false, "skip over damaged parts of the DUMP_II/III file and carry on with the next entry")
+	flag.BoolVar(&tapeImage, "tape", false, "the dump file is a SIMH/E11 tape image (assumed for .tap files)")
+	flag.IntVar(&tapeFile, "tapeFile", 0, "only load this file (from 1) of a tape image")
+	flag.BoolVar(&convertText, "text", false, "convert text files (FTXT) to host line endings and UTF-8 when extracting")
+	flag.StringVar(&textExts, "textExt", "", "also convert files with these comma-separated extensions with -text, eg. .SR,.CLI")
+	flag.StringVar(&udaOpts, "uda", "", "preserve UDAs of extracted files as comma-separated list of: sidecar,xattr")
+	flag.StringVar(&namePolicy, "names", "upper", "map AOS/VS names to host names by: upper, preserve, lower, escape or windows")
+	flag.StringVar(&nameMapFile, "nameMap", "", "write the AOS/VS pathname of every entry given a different host name to this file")
+	flag.BoolVar(&noTimes, "noTimes", false, "do not restore the AOS/VS modification and access times of extracted files")
+	flag.StringVar(&manifestDir, "manifest", "", "write a BagIt manifest of the file contents to this directory")
 	flag.BoolVar(&list, "list", false, "list the contents of the DUMP_II/III file")
 	flag.BoolVar(&list, "l", false, "list the contents of the DUMP_II/III file")
 	flag.BoolVar(&summary, "summary", true, "concise summary of the DUMP_II/III file contents")
 	flag.BoolVar(&summary, "s", true, "concise summary of the DUMP_II/III file contents")
+	flag.BoolVar(&verify, "verify", false, "check the integrity of the DUMP_II/III file without extracting anything, exit status 1 if problems are found")
 	flag.BoolVar(&verbose, "verbose", false, "be rather wordy about what loadg is doing")
 	flag.BoolVar(&verbose, "v", false, "be rather wordy about what loadg is doing")
 	flag.BoolVar(&version, "version", false, "show the version number of loadg and exit")
 	flag.BoolVar(&version, "V", false, "show the version number of loadg and exit")
-	flag.Parse()
 }
 
 func main() {
+	flag.Parse()
+	if flag.Arg(0) == "mount" {
+		// loadg mount <dumpfile> <mountpoint>
+		if flag.NArg() != 3 {
+			log.Fatalln("ERROR: Usage is: loadg mount <dumpfile> <mountpoint>")
+		}
+		if err := mountDump(flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		return
+	}
+	if flag.Arg(0) == "diff" {
+		// loadg diff <dumpfile> <dumpfile|directory>
+		if flag.NArg() != 3 {
+			log.Fatalln("ERROR: Usage is: loadg diff <dumpfile> <dumpfile or directory>")
+		}
+		same, err := diffDumps(flag.Arg(1), flag.Arg(2))
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if !same {
+			os.Exit(1)
+		}
+		return
+	}
+	if verbose && format != "" {
+		// the verbose output would be mixed into the listing
+		log.Fatalln("ERROR: Cannot use -verbose with -format")
+	}
 	if version || verbose {
 		fmt.Printf("loadg version %s\n", semVer)
 		if !verbose {
 			return
 		}
 	}
+	if err := parseACLOpts(aclOpts); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := parseUDAOpts(udaOpts); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := parseRecordsFormat(recordsFormat); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := parseHashOpts(hashOpts); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if err := parseNamePolicy(namePolicy); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if format != "" {
+		// keep the output clean of the human-readable listing
+		summary, list = false, false
+		var err error
+		if catalogue, err = newCatalogueWriter(format, os.Stdout); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+	}
+	if toTar != "" || toZip != "" {
+		if extract || (toTar != "" && toZip != "") {
+			log.Fatalln("ERROR: Only one of -extract, -to-tar and -to-zip may be used")
+		}
+		if toTar == "-" || toZip == "-" {
+			if verbose || format != "" {
+				log.Fatalln("ERROR: Cannot use -verbose or -format when writing an archive to stdout")
+			}
+			summary, list = false, false
+		}
+	}
 	if len(dump) == 0 {
 		log.Fatalln("ERROR: Must specify DUMP file name with -dumpFile <dumpfilename> option")
 	}
-	dumpFile, err := os.Open(dump)
+	if tapeFile == 0 && (format != "" || toTar != "" || toZip != "" || manifestDir != "" || nameMapFile != "") && isTape(dump) {
+		// there may be several dumps on the tape
+		log.Fatalln("ERROR: -format, -to-tar, -to-zip, -manifest and -nameMap need -tapeFile when reading a tape image")
+	}
+	if recoverDamage && isTape(dump) {
+		// the files on a tape image can only be read in sequence, so damage cannot be skipped over
+		log.Fatalln("ERROR: -recover is not supported for tape images")
+	}
+	if toTar != "" || toZip != "" {
+		if err := openArchive(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+	}
+	if manifestDir != "" {
+		if err := openManifests(); err != nil {
+			log.Fatalf("ERROR: Could not create manifest due to %v", err)
+		}
+	}
+	if nameMapFile != "" {
+		if err := openNameMap(); err != nil {
+			log.Fatalf("ERROR: Could not create name map due to %v", err)
+		}
+	}
+	volumeNames, err := dumpVolumeNames(dump, flag.Args())
 	if err != nil {
-		log.Fatalf("ERROR: Could not open dump file <%s> due to %v", dump, err)
+		log.Fatalf("ERROR: %v", err)
+	}
+	var dumpStream io.Reader
+	dumpName := volumeNames[0]
+	if len(volumeNames) == 1 {
+		if dumpStream, err = openDump(dumpName); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if dumpName == stdinName {
+			dumpName = "stdin"
+		}
+	} else {
+		if volumes, err = openVolumes(volumeNames); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		dumpStream = volumes
+		dumpName = fmt.Sprintf("%s and %d more volume(s)", dumpName, len(volumeNames)-1)
+	}
+
+	if recoverDamage && !seekable(dumpStream) {
+		log.Fatalln("ERROR: -recover is only supported for uncompressed dump files")
+	}
+	if isTape(volumeNames[0]) {
+		if useIndex {
+			log.Fatalln("ERROR: -index is not supported for tape images")
+		}
+		if !loadTape(dumpStream, dumpName) {
+			os.Exit(1)
+		}
+		return
+	}
+	if verify {
+		if !verifyDump(dumpStream, dumpName) {
+			os.Exit(1)
+		}
+		return
+	}
+	if useIndex {
+		dumpFile, isFile := dumpStream.(*os.File)
+		if !isFile {
+			log.Fatalln("ERROR: -index is only supported for uncompressed single-volume dump files")
+		}
+		ix, err := openIndex(dumpFile)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		loadIndexed(ix, dumpFile, dumpName)
+		return
 	}
-	defer dumpFile.Close()
+	loadDump(dumpStream, dumpName)
+}
 
+// loadDump lists and/or extracts the dump read from dumpFile according to the program flags
+func loadDump(dumpFile io.Reader, dumpName string) {
 	// dump images can legally contain 'too many' directory pops, so we
 	// store the starting directory and never traverse above it...
 	baseDir, _ = os.Getwd()
 	workingDir = baseDir
+	resetHostNames()
+
+	rdr := dumpfmt.NewReader(dumpFile)
 
 	// there should always be a SOD record...
-	sod := readSod(dumpFile)
-	if summary || verbose {
-		fmt.Printf("Summary of dump file : %s\n", dumpFile.Name())
-		fmt.Printf("AOS/VS dump version  : %d\n", sod.dumpFormatRevision)
-		fmt.Printf("Dump date (y-m-d)    : %d-%d-%d\n", sod.dumpTimeYear, sod.dumpTimeMonth, sod.dumpTimeDay)
-		fmt.Printf("Dump time( hh:mm:ss) : %02d:%02d:%02d\n", sod.dumpTimeHours, sod.dumpTimeMins, sod.dumpTimeSecs)
+	rec, err := rdr.Next()
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
 	}
+	showSOD(rec.(*dumpfmt.SOD), dumpName)
 
 	// now go through the dump examining each block type and acting accordingly...
-	done := false
-	for !done {
-		recHdr := readHeader(dumpFile)
-		if verbose {
-			fmt.Printf("Found block of type: %d, Length: %d\n", recHdr.recordType, recHdr.recordLength)
-		}
-		switch recHdr.recordType {
-		case startDumpType:
-			log.Fatalln("ERROR: Another START record found in DUMP - this should not happem.")
-		case fsbType:
-			fsbBlob = readBlob(recHdr.recordLength, dumpFile, "FSB")
-			loadIt = false
-		case nbType:
-			fileName = processNameBlock(recHdr, fsbBlob, dumpFile)
-		case udaType:
-			// throw away for now
-			_ = readBlob(recHdr.recordLength, dumpFile, "UDA")
-		case aclType:
-			aclBlob := readBlob(recHdr.recordLength, dumpFile, "ACL")
-			if verbose {
-				fmt.Printf(" ACL: %s\n", string(aclBlob))
+	for {
+		rec, err = rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !resync(rdr, err) {
+				break
 			}
-		case linkType:
-			processLink(recHdr, fileName, dumpFile)
-		case startBlockType:
-			// nothing to do - it's just a recHdr
-		case dataBlockType:
-			processDataBlock(recHdr, fsbBlob, dumpFile)
-		case endBlockType:
-			processEndBlock()
-		case endDumpType:
-			fmt.Println("=== End of Dump ===")
-			done = true
-		default:
-			log.Fatalf("ERROR: Unknown block type (%d) in dump file.  Giving up.", recHdr.recordType)
+			continue
 		}
+		processRecord(rec)
 	}
 }
 
-func processDataBlock(recHeader recordHeaderT, fsbBlob []byte, dumpFile *os.File) {
-	var dhb dataHeaderT
-
-	// first get the address and length
-	fourBytes := readBlob(4, dumpFile, "byte address")
-	dhb.byteAddress = DwordT(fourBytes[0])<<24 + DwordT(fourBytes[1])<<16 + DwordT(fourBytes[2])<<8 + DwordT(fourBytes[3])
-	fourBytes = readBlob(4, dumpFile, "byte length")
-	dhb.byteLength = DwordT(fourBytes[0])<<24 + DwordT(fourBytes[1])<<16 + DwordT(fourBytes[2])<<8 + DwordT(fourBytes[3])
-	if dhb.byteLength > maxBlockSize {
-		log.Fatalf("ERROR: Maximum block size exceeded ( %d vs. limit of %d).", dhb.byteLength, maxBlockSize)
+func showSOD(sod *dumpfmt.SOD, dumpName string) {
+	if summary || verbose {
+		fmt.Printf("Summary of dump file : %s\n", dumpName)
+		fmt.Printf("AOS/VS dump version  : %d\n", sod.DumpFormatRevision)
+		fmt.Printf("Dump date (y-m-d)    : %d-%d-%d\n", sod.DumpTimeYear, sod.DumpTimeMonth, sod.DumpTimeDay)
+		fmt.Printf("Dump time( hh:mm:ss) : %02d:%02d:%02d\n", sod.DumpTimeHours, sod.DumpTimeMins, sod.DumpTimeSecs)
 	}
-	twoBytes := readBlob(2, dumpFile, "alignment count")
-	dhb.alignmentCount = WordT(twoBytes[0])<<8 + WordT(twoBytes[1])
+}
+
+// processRecord acts upon each record after the SOD
+func processRecord(rec dumpfmt.Record) {
+	var err error
 	if verbose {
-		fmt.Printf(" Data block: %d (bytes)\n", dhb.byteLength)
+		fmt.Printf("Found block of type: %d, Length: %d\n", rec.Header().RecordType, rec.Header().RecordLength)
 	}
-
-	// skip any alignment bytes - usually just one
-	if dhb.alignmentCount > 0 {
+	switch r := rec.(type) {
+	case *dumpfmt.FSB:
+		fsb = r
+		loadIt = false
 		if verbose {
-			fmt.Printf("  Skipping %d alignment byte(s)\n", dhb.alignmentCount)
+			showFstat(r.Fstat)
+		}
+	case *dumpfmt.NameBlock:
+		fileName = processNameBlock(r, fsb)
+		fsb = nil // each entry has its own FSB
+	case *dumpfmt.UDA:
+		processUDA(r)
+	case *dumpfmt.ACL:
+		processACL(r)
+	case *dumpfmt.Link:
+		processLink(r, fileName)
+	case *dumpfmt.StartBlock:
+		// the file may have no data blocks, but its end block must not pop the directory
+		inFile = true
+		startHashes()
+		if arch != nil && loadIt && archPending != nil {
+			// the ACL and UDA are known by now
+			dataOut, err = arch.startFile(archPending)
+			checkArchive(err)
+			dataOut = convertFilter(dataOut, archPending.fstat, archPending.path)
+			writing = true
+		}
+	case *dumpfmt.DataBlock:
+		processDataBlock(r)
+	case *dumpfmt.EndBlock:
+		processEndBlock()
+	case *dumpfmt.EndOfDump:
+		// the dump may not have popped all the directories it entered
+		for len(dirStack) > 0 {
+			popDir()
+		}
+		if arch != nil {
+			checkArchive(closeArchive())
+		}
+		if err = closeManifests(); err != nil {
+			log.Fatalf("ERROR: Could not write manifest due to %v", err)
+		}
+		if err = closeNameMap(); err != nil {
+			log.Fatalf("ERROR: Could not write name map due to %v", err)
+		}
+		if catalogue != nil {
+			if err = catalogue.close(); err != nil {
+				log.Fatalf("ERROR: Could not write listing due to %v", err)
+			}
+		} else if archOut != os.Stdout {
+			fmt.Println("=== End of Dump ===")
 		}
-		readBlob(int(dhb.alignmentCount), dumpFile, "alignment byte(s)")
 	}
+}
 
-	dataBlob := readBlob(int(dhb.byteLength), dumpFile, "data block")
+func processDataBlock(db *dumpfmt.DataBlock) {
+	if verbose {
+		fmt.Printf(" Data block: %d (bytes)\n", db.ByteLength)
+		if db.AlignmentCount > 0 {
+			fmt.Printf("  Skipped %d alignment byte(s)\n", db.AlignmentCount)
+		}
+	}
 
 	// large areas of NULLs may be skipped over by DUMP_II/III
 	// this is achieved by simply advancing the byte address so
 	// we must pad out if byte address is beyond end of last block
-	//if extract && writeFile != nil {
-
-	if int(dhb.byteAddress) > totalFileSize+1 {
-		paddingSize := int(dhb.byteAddress) - totalFileSize
-		//fmt.Printf("File Size: %d, BA: %d, Padding Size: %d\n", totalFileSize, int(dhb.byteAddress), paddingSize)
-		paddingBlock := make([]byte, paddingSize)
-		if extract {
+	if int(db.ByteAddress) > totalFileSize {
+		paddingSize := int(db.ByteAddress) - totalFileSize
+		if writing {
 			if verbose {
-				fmt.Println("  Padding with one block")
+				fmt.Printf("  Padding with %d NULL(s)\n", paddingSize)
 			}
-			_, err := writeFile.Write(paddingBlock)
-			if err != nil {
+			if err := writeZeros(dataOut, int64(paddingSize)); err != nil {
 				log.Fatalf("ERROR: Could not write padding block due to %s", err.Error())
 			}
 		}
+		for _, h := range fileHashes {
+			writeZeros(h, int64(paddingSize))
+		}
 		totalFileSize += paddingSize
 	}
-	if extract {
-		n, err := writeFile.Write(dataBlob)
-		if n != int(dhb.byteLength) || err != nil {
-			log.Fatalf("ERROR: Could not write out data due to %s", err.Error())
+	hashData(db.Data)
+	if writing {
+		n, err := dataOut.Write(db.Data)
+		if n != int(db.ByteLength) || err != nil {
+			log.Fatalf("ERROR: Could not write out data due to %v", err)
 		}
 	}
-	//}
-	totalFileSize += int(dhb.byteLength)
+	totalFileSize += int(db.ByteLength)
 	inFile = true
 }
 
+// zeroBlock is written in place of the NULLs skipped by DUMP_II/III, a chunk at a time
+var zeroBlock = make([]byte, 4096)
+
+// writeZeros writes n NULLs to w
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		chunk := int64(len(zeroBlock))
+		if n < chunk {
+			chunk = n
+		}
+		if _, err := w.Write(zeroBlock[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
 func processEndBlock() {
 	if inFile {
-		if extract && loadIt {
+		if writing {
+			if err := endConversion(); err != nil {
+				log.Fatalf("ERROR: Could not write out data due to %v", err)
+			}
+		}
+		if writing && arch != nil {
+			checkArchive(arch.endFile())
+			writing = false
+		} else if writing {
 			writeFile.Close()
+			writing = false
+			applyACL(writePath, writeACL, false, isProgram(writeFstat.EntryType))
+			restoreTimes(writePath, writeFstat)
 		}
-		if summary {
+		if summary && entrySelected {
 			fmt.Printf(" %12d bytes\n", totalFileSize)
 		}
+		if err := endHashes(cataloguePath(entryPath)); err != nil {
+			log.Fatalf("ERROR: Could not write manifest due to %v", err)
+		}
+		if catalogue != nil {
+			catalogue.setSize(totalFileSize)
+		}
 		totalFileSize = 0
 		inFile = false
 	} else {
 		if workingDir != baseDir { // don't go up from start dir
 			workingDir = filepath.Dir(workingDir)
 		}
+		popDir()
+		if arch != nil {
+			checkArchive(archFlushDir())
+		}
 		if verbose {
 			fmt.Printf(" Popped dir - new dir is: %s\n", workingDir)
 		}
@@ -216,23 +463,46 @@ func processEndBlock() {
 	}
 }
 
-func processLink(recHeader recordHeaderT, linkName string, dumpFile *os.File) {
-	linkTargetBA := readBlob(recHeader.recordLength, dumpFile, "link target")
-	linkTargetBA = bytes.Trim(linkTargetBA, "\x00")
-	// convert AOS/VS : directory separators to platform-specific separators ("\", or "/")
-	linkTarget := strings.ToUpper(strings.Replace(string(linkTargetBA), ":", string(os.PathSeparator), -1))
-	if summary || verbose {
-		fmt.Printf(" -> Link Target: %s\n", linkTarget)
+func processLink(link *dumpfmt.Link, linkName string) {
+	// links are made relative to the directory containing them, with platform-specific separators ("\", or "/")
+	linkDir, _ := filepath.Rel(baseDir, workingDir)
+	linkTarget, targetErr := relativeLinkTarget(path.Join(filepath.ToSlash(linkDir), linkName), link.LinkResolutionName)
+	if (summary && entrySelected) || verbose {
+		if targetErr != nil {
+			fmt.Printf(" -> Link Target: %s\n", link.LinkResolutionName)
+		} else {
+			fmt.Printf(" -> Link Target: %s\n", filepath.FromSlash(linkTarget))
+		}
+	}
+	if catalogue != nil {
+		catalogue.setLinkTarget(link.LinkResolutionName)
 	}
-	if extract {
-		var oldName string
-		if len(workingDir) == 0 {
-			oldName = linkTarget
+	if arch != nil && entrySelected && archPending != nil {
+		// archived links are relative to the directory containing them, as are AOS/VS links
+		target, err := relativeLinkTarget(archPending.path, link.LinkResolutionName)
+		if err != nil {
+			log.Printf("ERROR: Not archiving %v", err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
 		} else {
-			oldName = filepath.Join(workingDir, linkTarget)
-			linkName = filepath.Join(workingDir, linkName)
+			checkArchive(arch.addLink(archPending, target))
+		}
+	}
+	if extract && entrySelected {
+		linkName = filepath.Join(workingDir, linkName)
+		if targetErr != nil {
+			log.Printf("ERROR: Not creating symbolic %v", targetErr)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+			return
+		}
+		oldName := filepath.FromSlash(linkTarget)
+		err := checkNoSymlinks(baseDir, workingDir)
+		if err == nil {
+			err = os.Symlink(oldName, linkName)
 		}
-		err := os.Symlink(oldName, linkName)
 		if err != nil {
 			log.Printf("ERROR: Could not create symbolic link, existing file %s, link name: %s, due to %v\n",
 				oldName, linkName, err)
@@ -243,105 +513,191 @@ func processLink(recHeader recordHeaderT, linkName string, dumpFile *os.File) {
 	}
 }
 
-func processNameBlock(recHeader recordHeaderT, fsbBlob []byte, dumpFile *os.File) string {
+func processNameBlock(nb *dumpfmt.NameBlock, fsb *dumpfmt.FSB) string {
 	var fileType string
-	nameBytes := readBlob(recHeader.recordLength, dumpFile, "file name")
-	fileName := strings.ToUpper(string(bytes.Trim(nameBytes, "\x00")))
+	if fsb == nil {
+		// without its FSB the type of the entry is unknown, so it can only be skipped
+		log.Printf("ERROR: Skipping name block %s at offset %d without an FSB", nb.FileName, nb.Offset)
+		if !ignoreErrors {
+			log.Fatalln("Giving up.")
+		}
+		entrySelected, entryIsDir, loadIt = false, false, false
+		if catalogue != nil {
+			if err := catalogue.flush(); err != nil {
+				log.Fatalf("ERROR: Could not write listing due to %v", err)
+			}
+		}
+		return ""
+	}
 	if summary && verbose {
 		fmt.Println()
 	}
-	thisEntryType, known := KnownFstatEntryTypes[fsbBlob[1]]
+	parentDumpPath := "."
+	if len(dirStack) > 0 {
+		parentDumpPath = dirStack[len(dirStack)-1].dumpPath
+	}
+	entryDumpPath = path.Join(parentDumpPath, strings.ToUpper(nb.FileName))
+	aosvsPath := nb.FileName
+	if len(dirStack) > 0 {
+		aosvsPath = dirStack[len(dirStack)-1].aosvsPath + ":" + nb.FileName
+	}
+	fileName := hostName(workingDir, nb.FileName)
+	thisEntryType, known := dumpfmt.KnownFstatEntryTypes[fsb.EntryType()]
+	entryIsDir = known && thisEntryType.IsDir
+	if len(workingDir) == 0 {
+		entryPath = fileName
+	} else {
+		entryPath = filepath.Join(workingDir, fileName)
+	}
+	entrySelected = selected(entryDumpPath)
+	if entrySelected && !entryIsDir {
+		registerDirs()
+		createHostName(workingDir, nb.FileName, fileName, aosvsPath)
+	}
 	if known {
 		fileType = thisEntryType.Desc
 		loadIt = thisEntryType.HasPayload
 		if thisEntryType.IsDir {
 			workingDir = filepath.Join(workingDir, fileName)
-			if extract {
-				err := os.MkdirAll(workingDir, os.ModePerm)
-				if err != nil {
-					log.Printf("ERROR: Could not create directory <%s> due to %v", workingDir, err)
-					if !ignoreErrors {
-						log.Fatalln("Giving up.")
-					}
-				}
+			entryPath = workingDir
+			dirStack = append(dirStack, dirEntry{path: workingDir, dumpPath: entryDumpPath, name: nb.FileName,
+				aosvsPath: aosvsPath, fstat: fsb.Fstat})
+			if entrySelected {
+				registerDirs()
 			}
 		}
 	} else {
 		fileType = "Unknown File"
 		loadIt = true
 	}
+	if extract && entrySelected {
+		makeWorkingDir()
+	}
+
+	if arch != nil {
+		checkArchive(archNewEntry(cataloguePath(entryPath), fsb.Fstat, entryIsDir, entrySelected))
+	}
 
-	if summary {
-		var displayPath string
-		if len(workingDir) == 0 {
-			displayPath = fileName
+	if catalogue != nil {
+		var err error
+		if entrySelected {
+			err = catalogue.start(cataloguePath(entryPath), fsb)
 		} else {
-			displayPath = filepath.Join(workingDir, fileName)
+			err = catalogue.flush()
 		}
-		fmt.Printf("%-20s: %-48s", fileType, displayPath)
-		if verbose || (known && thisEntryType.IsDir) {
+		if err != nil {
+			log.Fatalf("ERROR: Could not write listing due to %v", err)
+		}
+	}
+
+	if summary && entrySelected {
+		fmt.Printf("%-20s: %-48s", fileType, entryPath)
+		if verbose || list || entryIsDir {
 			fmt.Println()
 		} else {
 			fmt.Printf("\t")
 		}
 	}
 
-	if extract && loadIt {
-		var writePath string
-		if len(workingDir) == 0 {
-			writePath = fileName
-		} else {
-			writePath = filepath.Join(workingDir, fileName)
-		}
+	if extract && loadIt && entrySelected {
+		writeFstat = fsb.Fstat
+		writeACL = nil
+		writePath = entryPath
 		if verbose {
 			fmt.Printf(" Creating file: '%s'\n", writePath)
 		}
 		var err error
-		writeFile, err = os.Create(writePath)
+		writeFile, err = createFile(writePath)
 		if err != nil {
 			log.Printf("ERROR: Could not create file %s due to %s", writePath, err.Error())
 			if !ignoreErrors {
 				log.Fatalln("Giving up.")
 			}
+		} else {
+			dataOut = convertFilter(writeFile, writeFstat, fileName)
+			writing = true
 		}
 	}
 	return fileName
 }
 
-func readBlob(byteLen int, dumpFile *os.File, desc string) []byte {
-	ba := make([]byte, byteLen)
-	n, err := dumpFile.Read(ba)
-	if n != byteLen || err != nil {
-		log.Fatalf("ERROR: Could not read %s record due to %v", desc, err)
+// isProgram reports whether the FSTAT entry type is that of an executable program
+func isProgram(entryType byte) bool {
+	et, known := dumpfmt.KnownFstatEntryTypes[entryType]
+	return known && (et.DgMnemonic == "FPRG" || et.DgMnemonic == "FPRV")
+}
+
+// registerDirs takes the host names of the directories entered, now that something within them is selected
+func registerDirs() {
+	for i := range dirStack {
+		if dir := &dirStack[i]; !dir.registered {
+			createHostName(filepath.Dir(dir.path), dir.name, filepath.Base(dir.path), dir.aosvsPath)
+			dir.registered = true
+		}
+	}
+}
+
+// makeWorkingDir creates the current directory, and any containing it, if not already done
+func makeWorkingDir() {
+	if len(dirStack) > 0 && dirStack[len(dirStack)-1].created {
+		return
+	}
+	err := checkNoSymlinks(baseDir, workingDir)
+	if err == nil {
+		err = os.MkdirAll(workingDir, os.ModePerm)
+	}
+	if err != nil {
+		log.Printf("ERROR: Could not create directory <%s> due to %v", workingDir, err)
+		if !ignoreErrors {
+			log.Fatalln("Giving up.")
+		}
+		return
+	}
+	for i := range dirStack {
+		dirStack[i].created = true
 	}
-	return ba
 }
 
-func readAWord(dumpFile *os.File) WordT {
-	twoBytes := readBlob(2, dumpFile, "DG Word")
-	return WordT(twoBytes[0])<<8 | WordT(twoBytes[1])
+// popDir sets the times of the most recently entered directory, now that its contents have been loaded
+func popDir() {
+	if len(dirStack) == 0 {
+		return
+	}
+	dir := dirStack[len(dirStack)-1]
+	dirStack = dirStack[:len(dirStack)-1]
+	if extract && dir.created {
+		applyACL(dir.path, dir.acl, true, false)
+		restoreTimes(dir.path, dir.fstat)
+	}
+}
+
+// restoreTimes applies the AOS/VS access and modification times to an extracted file or directory
+func restoreTimes(path string, fs dumpfmt.Fstat) {
+	if noTimes || fs.Modified.IsZero() {
+		return
+	}
+	accessed := fs.Accessed
+	if accessed.IsZero() {
+		accessed = fs.Modified
+	}
+	if err := os.Chtimes(path, hostTime(accessed), hostTime(fs.Modified)); err != nil {
+		log.Printf("ERROR: Could not set times of %s due to %v", path, err)
+		if !ignoreErrors {
+			log.Fatalln("Giving up.")
+		}
+	}
 }
 
-func readHeader(dumpFile *os.File) recordHeaderT {
-	var hdr recordHeaderT
-	twoBytes := readBlob(2, dumpFile, "Header")
-	hdr.recordType = int(twoBytes[0]) >> 2 // 6-bit
-	hdr.recordLength = int(twoBytes[0]&0x03)<<8 + int(twoBytes[1])
-	return hdr
+// hostTime converts an AOS/VS time, which has no time zone, to the same wall-clock time on this host
+func hostTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
 }
 
-func readSod(dumpFile *os.File) sodT {
-	var sod sodT
-	sod.sodHeader = readHeader(dumpFile)
-	if sod.sodHeader.recordType != startDumpType {
-		log.Fatalln("ERROR: This does not appear to be an AOS/VS DUMP_II or DUMP_III file.")
-	}
-	sod.dumpFormatRevision = readAWord(dumpFile)
-	sod.dumpTimeSecs = readAWord(dumpFile)
-	sod.dumpTimeMins = readAWord(dumpFile)
-	sod.dumpTimeHours = readAWord(dumpFile)
-	sod.dumpTimeDay = readAWord(dumpFile)
-	sod.dumpTimeMonth = readAWord(dumpFile)
-	sod.dumpTimeYear = readAWord(dumpFile)
-	return sod
+func showFstat(fs dumpfmt.Fstat) {
+	const timeFmt = "2006-01-02 15:04:05"
+	fmt.Printf(" Record format: %s, Record length: %d, Element size: %d, Index levels: %d (max %d)\n",
+		fs.RecordFormatName(), fs.RecordLength, fs.ElementSize, fs.IndexLevels, fs.MaxIndexLevels)
+	fmt.Printf(" Length: %d bytes, Hash frame size: %d\n", fs.FileLength, fs.HashFrameSize)
+	fmt.Printf(" Created: %s, Accessed: %s, Modified: %s\n",
+		fs.Created.Format(timeFmt), fs.Accessed.Format(timeFmt), fs.Modified.Format(timeFmt))
 }
@@ -1,10 +1,452 @@
 package main
 
-import "testing"
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
 
-func TestGetKnownEntryTypes(t *testing.T) {
-	fmtf := KnownFstatEntryTypes[2]
-	if "FMTF" != fmtf.DgMnemonic {
-		t.Errorf("Expected 'FMTF', got '%s'", fmtf.DgMnemonic)
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// dumpBuilder generates synthetic dump images in memory
+type dumpBuilder struct {
+	t   *testing.T
+	buf bytes.Buffer
+	dw  *dumpfmt.Writer
+	acl []dumpfmt.ACLEntry // given to each entry
+}
+
+type dataBlock struct {
+	addr int64
+	data []byte
+}
+
+func newDumpBuilder(t *testing.T) *dumpBuilder {
+	db := &dumpBuilder{t: t, acl: []dumpfmt.ACLEntry{{UserPattern: "+", Access: dumpfmt.AccessRead}}}
+	db.dw = dumpfmt.NewWriter(&db.buf)
+	db.check(db.dw.WriteSOD(dumpfmt.SOD{DumpFormatRevision: 16, DumpTimeYear: 1994, DumpTimeMonth: 7, DumpTimeDay: 21, DumpTimeHours: 9}))
+	return db
+}
+
+func (db *dumpBuilder) check(err error) {
+	if err != nil {
+		db.t.Fatalf("Could not build dump: %v", err)
+	}
+}
+
+func (db *dumpBuilder) header(entryType byte, name string) {
+	db.fstatHeader(dumpfmt.Fstat{EntryType: entryType}, name)
+}
+
+func (db *dumpBuilder) fstatHeader(fs dumpfmt.Fstat, name string) {
+	db.check(db.dw.WriteFSB(fs))
+	db.check(db.dw.WriteName(name))
+	db.check(db.dw.WriteACL(db.acl))
+}
+
+// withACL gives the entries which follow the ACL, eg. "SMERRONY,OWARE +,RE"
+func (db *dumpBuilder) withACL(acl string) *dumpBuilder {
+	var err error
+	db.acl, err = dumpfmt.ParseACL(acl)
+	db.check(err)
+	return db
+}
+
+func (db *dumpBuilder) dir(name string) *dumpBuilder {
+	db.header(10, name)
+	return db
+}
+
+func (db *dumpBuilder) end() *dumpBuilder {
+	db.check(db.dw.WriteEndBlock())
+	return db
+}
+
+func (db *dumpBuilder) file(entryType byte, name string, blocks ...dataBlock) *dumpBuilder {
+	return db.fstatFile(dumpfmt.Fstat{EntryType: entryType}, name, blocks...)
+}
+
+// fstatFile adds a file with the given FSTAT packet, eg. to set its record format or times
+func (db *dumpBuilder) fstatFile(fs dumpfmt.Fstat, name string, blocks ...dataBlock) *dumpBuilder {
+	db.fstatHeader(fs, name)
+	db.check(db.dw.WriteStartBlock())
+	for _, b := range blocks {
+		db.check(db.dw.WriteDataBlock(b.addr, b.data))
+	}
+	return db.end()
+}
+
+func (db *dumpBuilder) link(name, target string) *dumpBuilder {
+	db.header(0, name)
+	db.check(db.dw.WriteLink(target))
+	return db
+}
+
+func (db *dumpBuilder) bytes() []byte {
+	db.check(db.dw.WriteEndOfDump())
+	return db.buf.Bytes()
+}
+
+// runLoadg runs loadg over the dump in a new temporary directory returning
+// the output and the directory
+func runLoadg(t *testing.T, dump []byte, doExtract bool) (string, string) {
+	return runLoader(t, doExtract, func() { loadDump(bytes.NewReader(dump), "TEST.DMP") })
+}
+
+func runLoader(t *testing.T, doExtract bool, load func()) (string, string) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldWd, _ := os.Getwd()
+	if err = os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(oldWd)
+
+	extract, summary, list, verbose, noTimes = doExtract, true, false, false, true
+	fsb, inFile, loadIt, writing, totalFileSize, dirStack = nil, false, false, false, 0, nil
+
+	oldStdout := os.Stdout
+	rd, wr, _ := os.Pipe()
+	os.Stdout = wr
+	outCh := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(rd)
+		outCh <- string(out)
+	}()
+	load()
+	wr.Close()
+	os.Stdout = oldStdout
+	return <-outCh, tmpDir
+}
+
+// extractedTree describes the extracted files: contents for files, "->target" for links and "/" for directories
+func extractedTree(t *testing.T, root string) map[string]string {
+	tree := map[string]string{}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(root, path)
+		switch {
+		case rel == ".":
+		case info.Mode()&os.ModeSymlink != 0:
+			target, _ := os.Readlink(path)
+			tree[filepath.ToSlash(rel)] = "->" + target
+		case info.IsDir():
+			tree[filepath.ToSlash(rel)] = "/"
+		default:
+			content, _ := os.ReadFile(path)
+			tree[filepath.ToSlash(rel)] = string(content)
+		}
+		return nil
+	})
+	return tree
+}
+
+func compareTrees(t *testing.T, got, want map[string]string) {
+	var paths []string
+	for p := range want {
+		paths = append(paths, p)
+	}
+	for p := range got {
+		if _, found := want[p]; !found {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		g, gFound := got[p]
+		w, wFound := want[p]
+		switch {
+		case !gFound:
+			t.Errorf("Expected %s was not extracted", p)
+		case !wFound:
+			t.Errorf("Unexpected %s was extracted", p)
+		case g != w:
+			t.Errorf("%s: expected %d bytes %q..., got %d bytes %q...", p, len(w), trunc(w), len(g), trunc(g))
+		}
 	}
 }
+
+func trunc(s string) string {
+	if len(s) > 16 {
+		return s[:16]
+	}
+	return s
+}
+
+func sampleDump(t *testing.T) []byte {
+	return newDumpBuilder(t).
+		dir("UDD").
+		dir("src").
+		file(68, "hello.txt", dataBlock{0, []byte("HELLO\nWORLD\n")}).
+		file(64, "SPARSE", dataBlock{0, bytes.Repeat([]byte{'A'}, 512)}, dataBlock{2048, []byte("END")}).
+		file(64, "EMPTY").
+		end().
+		link("HELLO", "UDD:SRC:HELLO.TXT").
+		file(99, "MYSTERY", dataBlock{0, []byte{1, 2, 3}}).
+		end().
+		file(87, "TOP.PR", dataBlock{0, []byte("PROG")}).
+		end(). // one pop too many - must not leave the base directory
+		end().
+		file(68, "LAST.CLI", dataBlock{0, []byte("WRITE DONE\n")}).
+		bytes()
+}
+
+func TestListing(t *testing.T) {
+	out, base := runLoadg(t, sampleDump(t), false)
+	entry := func(desc, path string) string {
+		return fmt.Sprintf("%-20s: %-48s", desc, filepath.Join(base, path))
+	}
+	want := "Summary of dump file : TEST.DMP\n" +
+		"AOS/VS dump version  : 16\n" +
+		"Dump date (y-m-d)    : 1994-7-21\n" +
+		"Dump time( hh:mm:ss) : 09:00:00\n" +
+		entry("<Directory>", "UDD") + "\n" +
+		entry("<Directory>", "UDD/SRC") + "\n" +
+		entry("Text File", "UDD/SRC/HELLO.TXT") + "\t           12 bytes\n" +
+		entry("User Data File", "UDD/SRC/SPARSE") + "\t         2051 bytes\n" +
+		entry("User Data File", "UDD/SRC/EMPTY") + "\t            0 bytes\n" +
+		entry("=>Link=>", "UDD/HELLO") + "\t -> Link Target: UDD/SRC/HELLO.TXT\n" +
+		entry("Unknown File", "UDD/MYSTERY") + "\t            3 bytes\n" +
+		entry("Program File", "TOP.PR") + "\t            4 bytes\n" +
+		entry("Text File", "LAST.CLI") + "\t           11 bytes\n" +
+		"=== End of Dump ===\n"
+	if out != want {
+		t.Errorf("Listing mismatch\nexpected:\n%s\ngot:\n%s", want, out)
+	}
+}
+
+func TestExtraction(t *testing.T) {
+	_, base := runLoadg(t, sampleDump(t), true)
+	sparse := bytes.Repeat([]byte{'A'}, 512)
+	sparse = append(sparse, make([]byte, 2048-512)...)
+	sparse = append(sparse, "END"...)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"UDD":               "/",
+		"UDD/SRC":           "/",
+		"UDD/SRC/HELLO.TXT": "HELLO\nWORLD\n",
+		"UDD/SRC/SPARSE":    string(sparse),
+		"UDD/SRC/EMPTY":     "",
+		"UDD/HELLO":         "->UDD/SRC/HELLO.TXT",
+		"UDD/MYSTERY":       "\x01\x02\x03",
+		"TOP.PR":            "PROG",
+		"LAST.CLI":          "WRITE DONE\n",
+	})
+}
+
+func TestPadding(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []dataBlock
+		want   string
+	}{
+		{"contiguous", []dataBlock{{0, []byte("AB")}, {2, []byte("CD")}}, "ABCD"},
+		{"one byte gap", []dataBlock{{0, []byte("AB")}, {3, []byte("CD")}}, "AB\x00CD"},
+		{"leading gap", []dataBlock{{4, []byte("XY")}}, "\x00\x00\x00\x00XY"},
+		{"several gaps", []dataBlock{{1, []byte("A")}, {5, []byte("B")}, {7, []byte("C")}}, "\x00A\x00\x00\x00B\x00C"},
+	}
+	for _, tt := range tests {
+		dump := newDumpBuilder(t).file(64, "F", tt.blocks...).bytes()
+		_, base := runLoadg(t, dump, true)
+		got, err := os.ReadFile(filepath.Join(base, "F"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDirectoryPopping(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("A").dir("B").dir("C").
+		file(68, "IN_C", dataBlock{0, []byte("C")}).
+		end().
+		file(68, "IN_B", dataBlock{0, []byte("B")}).
+		end().end().
+		file(68, "AT_TOP", dataBlock{0, []byte("T")}).
+		end().end().end().
+		file(68, "STILL_TOP", dataBlock{0, []byte("S")}).
+		bytes()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"A":          "/",
+		"A/B":        "/",
+		"A/B/C":      "/",
+		"A/B/C/IN_C": "C",
+		"A/B/IN_B":   "B",
+		"AT_TOP":     "T",
+		"STILL_TOP":  "S",
+	})
+}
+
+// runArchive converts the dump to an archive of the given kind returning the archive file name
+func runArchive(t *testing.T, dump []byte, kind string) string {
+	name := filepath.Join(t.TempDir(), "out."+kind)
+	toTar, toZip = "", ""
+	if kind == "zip" {
+		toZip = name
+	} else {
+		toTar = name
+	}
+	defer func() { toTar, toZip, arch, archOut, archPending, archPendingDir = "", "", nil, nil, nil, false }()
+	if err := openArchive(); err != nil {
+		t.Fatal(err)
+	}
+	runLoadg(t, dump, false)
+	return name
+}
+
+func TestTarArchive(t *testing.T) {
+	name := runArchive(t, sampleDump(t), "tar")
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got := map[string]string{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			got[hdr.Name] = "/"
+		case tar.TypeSymlink:
+			got[hdr.Name] = "->" + hdr.Linkname
+		default:
+			content, _ := io.ReadAll(tr)
+			got[hdr.Name] = string(content)
+		}
+		if hdr.Name == "UDD/SRC/HELLO.TXT" {
+			if hdr.PAXRecords[paxTypeKey] != "FTXT" || hdr.PAXRecords[paxACLKey] != "+,R" {
+				t.Errorf("Expected AOS/VS type and ACL in PAX records, got %v", hdr.PAXRecords)
+			}
+		}
+	}
+	sparse := bytes.Repeat([]byte{'A'}, 512)
+	sparse = append(sparse, make([]byte, 2048-512)...)
+	sparse = append(sparse, "END"...)
+	compareTrees(t, got, map[string]string{
+		"UDD/":              "/",
+		"UDD/SRC/":          "/",
+		"UDD/SRC/HELLO.TXT": "HELLO\nWORLD\n",
+		"UDD/SRC/SPARSE":    string(sparse),
+		"UDD/SRC/EMPTY":     "",
+		"UDD/HELLO":         "->UDD/SRC/HELLO.TXT",
+		"UDD/MYSTERY":       "\x01\x02\x03",
+		"TOP.PR":            "PROG",
+		"LAST.CLI":          "WRITE DONE\n",
+	})
+}
+
+func TestZipArchive(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("D").
+		file(68, "T.TXT", dataBlock{0, []byte("TEXT")}).
+		link("L", "T.TXT").
+		end().
+		bytes()
+	zr, err := zip.OpenReader(runArchive(t, dump, "zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	got := map[string]string{}
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		switch {
+		case zf.Mode().IsDir():
+			got[zf.Name] = "/"
+		case zf.Mode()&os.ModeSymlink != 0:
+			got[zf.Name] = "->" + string(content)
+		default:
+			got[zf.Name] = string(content)
+		}
+		if zf.Name == "D/T.TXT" && !bytes.Contains(zf.Extra, []byte("user.aosvs.type=FTXT\n")) {
+			t.Errorf("Expected AOS/VS type in extra field, got %q", zf.Extra)
+		}
+	}
+	compareTrees(t, got, map[string]string{
+		"D/":      "/",
+		"D/T.TXT": "TEXT",
+		"D/L":     "->T.TXT",
+	})
+}
+
+func TestIndexedMatchesStreamed(t *testing.T) {
+	dump := sampleDump(t)
+	ix, err := dumpfmt.BuildIndex(bytes.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved bytes.Buffer
+	if err = ix.Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if ix, err = dumpfmt.ReadIndex(&saved); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { includes = nil }()
+	var sparseOnly patternList
+	sparseOnly.Set("UDD/SRC/SPARSE")
+	for _, inc := range []patternList{nil, sparseOnly} {
+		includes = inc
+		for _, doExtract := range []bool{false, true} {
+			streamedOut, streamedDir := runLoadg(t, dump, doExtract)
+			indexedOut, indexedDir := runLoader(t, doExtract, func() { loadIndexed(ix, bytes.NewReader(dump), "TEST.DMP") })
+			if strings.ReplaceAll(indexedOut, indexedDir, "") != strings.ReplaceAll(streamedOut, streamedDir, "") {
+				t.Errorf("Output differs, streamed:\n%s\nindexed:\n%s", streamedOut, indexedOut)
+			}
+			compareTrees(t, extractedTree(t, indexedDir), extractedTree(t, streamedDir))
+		}
+	}
+
+	// the names in the dump are replayed, not the upper-cased index paths
+	includes = nil
+	dump = newDumpBuilder(t).dir("Udd").file(68, "Hello.txt", dataBlock{0, []byte("HI")}).end().bytes()
+	if ix, err = dumpfmt.BuildIndex(bytes.NewReader(dump)); err != nil {
+		t.Fatal(err)
+	}
+	if err = parseNamePolicy("preserve"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { mapName = namePolicies["upper"] }()
+	_, indexedDir := runLoader(t, true, func() { loadIndexed(ix, bytes.NewReader(dump), "TEST.DMP") })
+	compareTrees(t, extractedTree(t, indexedDir), map[string]string{"Udd": "/", "Udd/Hello.txt": "HI"})
+}
+
+func TestNameBlockWithoutFSB(t *testing.T) {
+	db := newDumpBuilder(t)
+	db.check(db.dw.WriteName("ORPHAN"))
+	db.check(db.dw.WriteStartBlock())
+	db.check(db.dw.WriteDataBlock(0, []byte("LOST")))
+	db.check(db.dw.WriteEndBlock())
+	dump := db.file(68, "F", dataBlock{0, []byte("FOUND")}).bytes()
+
+	ignoreErrors = true
+	defer func() { ignoreErrors = false }()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{"F": "FOUND"})
+}
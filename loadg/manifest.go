@@ -0,0 +1,139 @@
+// manifest.go - content hashing and BagIt manifests for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bagitDeclaration is the bagit.txt file written with a manifest
+const bagitDeclaration = "BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n"
+
+var (
+	hashOpts, manifestDir string
+	hashNames             []string    // the BagIt names of the algorithms in use
+	fileHashes            []hash.Hash // of the current file, nil if it is not being hashed
+	manifestFiles         []*os.File
+	manifests             []*bufio.Writer
+)
+
+var newHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+func parseHashOpts(opts string) error {
+	if opts != "" {
+		for _, opt := range strings.Split(opts, ",") {
+			if _, known := newHashes[opt]; !known {
+				return fmt.Errorf("unknown hash <%s>, expected sha256 and/or md5", opt)
+			}
+			hashNames = append(hashNames, opt)
+		}
+	}
+	if manifestDir != "" && len(hashNames) == 0 {
+		hashNames = []string{"sha256"}
+	}
+	return nil
+}
+
+// openManifests creates the BagIt declaration and a manifest for each hash in the -manifest directory
+func openManifests() error {
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(manifestDir, "bagit.txt"), []byte(bagitDeclaration), 0644); err != nil {
+		return err
+	}
+	for _, name := range hashNames {
+		f, err := os.Create(filepath.Join(manifestDir, "manifest-"+name+".txt"))
+		if err != nil {
+			return err
+		}
+		manifestFiles = append(manifestFiles, f)
+		manifests = append(manifests, bufio.NewWriter(f))
+	}
+	return nil
+}
+
+func closeManifests() error {
+	for i, f := range manifestFiles {
+		if err := manifests[i].Flush(); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	manifestFiles, manifests = nil, nil
+	return nil
+}
+
+// startHashes begins hashing the contents of the current file if it is selected
+func startHashes() {
+	fileHashes = nil
+	if len(hashNames) == 0 || !entrySelected {
+		return
+	}
+	for _, name := range hashNames {
+		fileHashes = append(fileHashes, newHashes[name]())
+	}
+}
+
+func hashData(p []byte) {
+	for _, h := range fileHashes {
+		h.Write(p)
+	}
+}
+
+// manifestEscaper percent-encodes the characters which may not appear literally in a manifest path (RFC 8493 2.1.3)
+var manifestEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// endHashes shows the digests of the current file and adds them to the manifests,
+// relPath is the path of the file within the dump
+func endHashes(relPath string) error {
+	if fileHashes == nil {
+		return nil
+	}
+	for i, h := range fileHashes {
+		digest := hex.EncodeToString(h.Sum(nil))
+		if summary {
+			fmt.Printf(" %s: %s\n", hashNames[i], digest)
+		}
+		if manifests != nil {
+			// the bag's payload is under data/
+			if _, err := fmt.Fprintf(manifests[i], "%s  data/%s\n", digest, manifestEscaper.Replace(relPath)); err != nil {
+				return err
+			}
+		}
+	}
+	fileHashes = nil
+	return nil
+}
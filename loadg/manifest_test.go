@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	manifestDir = t.TempDir()
+	defer func() { manifestDir, hashNames = "", nil }()
+	if err := parseHashOpts("sha256,md5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := openManifests(); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := runLoadg(t, sampleDump(t), false)
+
+	sparse := bytes.Repeat([]byte{'A'}, 512)
+	sparse = append(sparse, make([]byte, 2048-512)...)
+	sparse = append(sparse, "END"...)
+	if want := fmt.Sprintf(" sha256: %x\n md5: %x\n", sha256.Sum256(sparse), md5.Sum(sparse)); !strings.Contains(out, want) {
+		t.Errorf("Expected listing to contain\n%s\ngot:\n%s", want, out)
+	}
+	manifest, err := os.ReadFile(filepath.Join(manifestDir, "manifest-sha256.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	for _, f := range []struct{ path, data string }{
+		{"UDD/SRC/HELLO.TXT", "HELLO\nWORLD\n"},
+		{"UDD/SRC/SPARSE", string(sparse)},
+		{"UDD/SRC/EMPTY", ""},
+		{"UDD/MYSTERY", "\x01\x02\x03"},
+		{"TOP.PR", "PROG"},
+		{"LAST.CLI", "WRITE DONE\n"},
+	} {
+		fmt.Fprintf(&want, "%x  data/%s\n", sha256.Sum256([]byte(f.data)), f.path)
+	}
+	if string(manifest) != want.String() {
+		t.Errorf("Manifest mismatch\nexpected:\n%s\ngot:\n%s", want.String(), manifest)
+	}
+	if bagit, err := os.ReadFile(filepath.Join(manifestDir, "bagit.txt")); err != nil || string(bagit) != bagitDeclaration {
+		t.Errorf("Missing or incorrect bagit.txt, %v", err)
+	}
+}
+
+func TestManifestEscapedNames(t *testing.T) {
+	manifestDir = t.TempDir()
+	defer func() { manifestDir, hashNames, mapName = "", nil, namePolicies["upper"] }()
+	if err := parseHashOpts(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseNamePolicy("escape"); err != nil {
+		t.Fatal(err)
+	}
+	if err := openManifests(); err != nil {
+		t.Fatal(err)
+	}
+	// the gap is larger than the NULLs written at a time
+	gappy := append([]byte("A"), make([]byte, 9999)...)
+	gappy = append(gappy, 'B')
+	dump := newDumpBuilder(t).
+		dir("UDD").
+		file(68, "WHAT?", dataBlock{0, []byte("WHAT")}).
+		file(68, "GAPPY", dataBlock{0, []byte("A")}, dataBlock{10000, []byte("B")}).
+		end().
+		bytes()
+	_, base := runLoadg(t, dump, true)
+
+	if got, err := os.ReadFile(filepath.Join(base, "UDD", "GAPPY")); err != nil || !bytes.Equal(got, gappy) {
+		t.Errorf("Expected %d bytes with a gap of NULLs, got %d, %v", len(gappy), len(got), err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(manifestDir, "manifest-sha256.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%x  data/UDD/WHAT%%253F\n%x  data/UDD/GAPPY\n", sha256.Sum256([]byte("WHAT")), sha256.Sum256(gappy))
+	if string(manifest) != want {
+		t.Errorf("Manifest mismatch\nexpected:\n%s\ngot:\n%s", want, manifest)
+	}
+}
+
+func TestManifestEscaper(t *testing.T) {
+	if got := manifestEscaper.Replace("A%B\r\nC"); got != "A%25B%0D%0AC" {
+		t.Errorf("Expected A%%25B%%0D%%0AC, got %s", got)
+	}
+}
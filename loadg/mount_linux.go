@@ -0,0 +1,152 @@
+// mount_linux.go - read-only FUSE mount of a dump for loadg on Linux
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// mountNode is a file or directory of a mounted dump, links are served by fs.MemSymlink
+type mountNode struct {
+	fs.Inode
+	entry *dumpfmt.IndexEntry
+	dump  *os.File
+}
+
+var (
+	_ = (fs.NodeOnAdder)((*mountNode)(nil))
+	_ = (fs.NodeGetattrer)((*mountNode)(nil))
+	_ = (fs.NodeOpener)((*mountNode)(nil))
+	_ = (fs.NodeReader)((*mountNode)(nil))
+)
+
+// OnAdd builds the whole tree when the root is mounted as the index is already in memory
+func (mn *mountNode) OnAdd(ctx context.Context) {
+	if mn.entry.Path == "." {
+		mn.addChildren(ctx)
+	}
+}
+
+func (mn *mountNode) addChildren(ctx context.Context) {
+	for _, e := range mn.entry.Children {
+		var child *fs.Inode
+		switch {
+		case e.IsLink():
+			target, ok := e.HostLinkTarget()
+			if !ok {
+				log.Printf("WARNING: Not mounting link %s to %s, it leads outside the dump\n", e.Path, e.LinkTarget)
+				continue
+			}
+			child = mn.NewPersistentInode(ctx, &fs.MemSymlink{Data: []byte(target)}, fs.StableAttr{Mode: fuse.S_IFLNK})
+		case e.IsDir():
+			dir := &mountNode{entry: e, dump: mn.dump}
+			child = mn.NewPersistentInode(ctx, dir, fs.StableAttr{Mode: fuse.S_IFDIR})
+			mn.AddChild(path.Base(e.Path), child, true)
+			dir.addChildren(ctx)
+			continue
+		default:
+			child = mn.NewPersistentInode(ctx, &mountNode{entry: e, dump: mn.dump}, fs.StableAttr{Mode: fuse.S_IFREG})
+		}
+		mn.AddChild(path.Base(e.Path), child, true)
+	}
+}
+
+func (mn *mountNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	fstat := mn.entry.Fstat
+	switch {
+	case mn.entry.IsDir():
+		out.Mode = 0555
+	case isProgram(fstat.EntryType):
+		out.Mode = 0555
+	default:
+		out.Mode = 0444
+	}
+	out.Size = uint64(mn.entry.Size)
+	out.Blocks = (out.Size + 511) / 512
+	if !fstat.Modified.IsZero() {
+		out.Mtime = uint64(hostTime(fstat.Modified).Unix())
+		out.Atime, out.Ctime = out.Mtime, out.Mtime
+	}
+	if !fstat.Accessed.IsZero() {
+		out.Atime = uint64(hostTime(fstat.Accessed).Unix())
+	}
+	return 0
+}
+
+func (mn *mountNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	// the contents never change
+	return nil, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (mn *mountNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := mn.entry.ReadAt(mn.dump, dest, off)
+	if n == 0 && err != nil && off < mn.entry.Size {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// mountDump serves the dump as a read-only filesystem at mountPoint until it is unmounted or interrupted
+func mountDump(dumpName, mountPoint string) error {
+	dumpFile, err := os.Open(dumpName)
+	if err != nil {
+		return fmt.Errorf("could not open dump file <%s> due to %v", dumpName, err)
+	}
+	defer dumpFile.Close()
+	ix, err := dumpfmt.BuildIndex(dumpFile)
+	if err != nil {
+		return err
+	}
+	root := &mountNode{entry: ix.Root, dump: dumpFile}
+	server, err := fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{FsName: dumpName, Name: "loadg", Options: []string{"ro"}, Debug: verbose,
+			// mount(2) works without fusermount when run as root, otherwise fusermount is used
+			DirectMount: true},
+	})
+	if err != nil {
+		return fmt.Errorf("could not mount dump on <%s> due to %v", mountPoint, err)
+	}
+	if summary {
+		fmt.Printf("Mounted %s on %s, unmount with: fusermount -u %s\n", dumpName, mountPoint, mountPoint)
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		server.Unmount()
+	}()
+	server.Wait()
+	return nil
+}
@@ -0,0 +1,173 @@
+// names.go - mapping of AOS/VS names to host names for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	namePolicy  string
+	nameMapFile string
+	mapName     = strings.ToUpper
+	hostPaths   = map[string]bool{}   // lower-cased host paths of the entries created, to find collisions
+	renamed     = map[string]string{} // host names of entries renamed to avoid a collision, by parent host path and dumped name
+	collisions  int
+	nameMapW    *bufio.Writer
+	nameMapF    *os.File
+)
+
+// namePolicies map AOS/VS names to host names, the default is to upper-case them
+var namePolicies = map[string]func(name string) string{
+	"upper":    strings.ToUpper,
+	"preserve": func(name string) string { return name },
+	"lower":    strings.ToLower,
+	"escape":   escapeName,
+	"windows":  windowsName,
+}
+
+// windowsReserved are device names which Windows does not allow as file names, with or without an extension
+var windowsReserved = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true}
+
+func parseNamePolicy(policy string) error {
+	var known bool
+	if mapName, known = namePolicies[policy]; !known {
+		return fmt.Errorf("unknown name policy <%s>, expected upper, preserve, lower, escape or windows", policy)
+	}
+	return nil
+}
+
+// escapeByte returns a character as %XX
+func escapeByte(c byte) string {
+	return fmt.Sprintf("%%%02X", c)
+}
+
+// escapeName upper-cases the name and replaces every character except letters, digits, '.', '_' and '-' with %XX
+func escapeName(name string) string {
+	var sb strings.Builder
+	for _, c := range []byte(strings.ToUpper(name)) {
+		if c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-' {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteString(escapeByte(c))
+		}
+	}
+	return sb.String()
+}
+
+// windowsName upper-cases the name and replaces characters Windows does not allow with %XX,
+// as well as trailing dots and the first character of reserved device names
+func windowsName(name string) string {
+	var sb strings.Builder
+	upper := []byte(strings.ToUpper(name))
+	base := strings.SplitN(string(upper), ".", 2)[0]
+	for i, c := range upper {
+		switch {
+		case c < ' ' || strings.IndexByte(`<>:"/\|?*%`, c) >= 0,
+			i == 0 && windowsReserved[base],
+			c == '.' && strings.Trim(string(upper[i:]), ".") == "":
+			sb.WriteString(escapeByte(c))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// openNameMap creates the -nameMap file
+func openNameMap() error {
+	var err error
+	if nameMapF, err = os.Create(nameMapFile); err != nil {
+		return err
+	}
+	nameMapW = bufio.NewWriter(nameMapF)
+	return nil
+}
+
+func closeNameMap() error {
+	if collisions > 0 {
+		log.Printf("WARNING: %d name collision(s) were avoided by renaming", collisions)
+		collisions = 0
+	}
+	if nameMapF == nil {
+		return nil
+	}
+	if err := nameMapW.Flush(); err != nil {
+		return err
+	}
+	err := nameMapF.Close()
+	nameMapF, nameMapW = nil, nil
+	return err
+}
+
+// resetHostNames forgets the host names of the entries of any previous dump
+func resetHostNames() {
+	hostPaths = map[string]bool{}
+	renamed = map[string]string{}
+}
+
+// hostName returns the host name for an entry in directory dir.  An entry whose name would collide with
+// one already created on a case-insensitive filesystem is renamed by adding ~N.
+func hostName(dir, name string) string {
+	mapped := safeName(mapName(name))
+	unique := mapped
+	for n := 1; hostPaths[strings.ToLower(filepath.Join(dir, unique))]; n++ {
+		unique = fmt.Sprintf("%s~%d", mapped, n)
+	}
+	return unique
+}
+
+// createHostName registers the host name given to an entry which is to be created, and records it in any
+// name map, aosvsPath being the ':'-separated path of the entry in the dump
+func createHostName(dir, name, unique, aosvsPath string) {
+	hostPaths[strings.ToLower(filepath.Join(dir, unique))] = true
+	if unique != safeName(mapName(name)) {
+		collisions++
+		renamed[path.Join(cataloguePath(dir), name)] = unique
+		log.Printf("WARNING: %s would overwrite an earlier entry, using %s", aosvsPath, unique)
+	}
+	if nameMapW != nil {
+		if hostPath := cataloguePath(filepath.Join(dir, unique)); hostPath != strings.Replace(aosvsPath, ":", "/", -1) {
+			// the AOS/VS pathname of each entry with a different host name, so that it may be restored
+			if _, err := fmt.Fprintf(nameMapW, "%s\t%s\n", hostPath, aosvsPath); err != nil {
+				log.Fatalf("ERROR: Could not write name map due to %v", err)
+			}
+		}
+	}
+}
+
+// hostLinkName maps each name in a link target as the entry it leads to was named when extracted,
+// parent being the host path of its directory relative to the top
+func hostLinkName(parent, name string) string {
+	if unique, found := renamed[path.Join(parent, name)]; found {
+		return unique
+	}
+	return safeName(mapName(name))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNameMapping(t *testing.T) {
+	tests := []struct {
+		name, escaped, windows string
+	}{
+		{"HELLO.TXT", "HELLO.TXT", "HELLO.TXT"},
+		{"what?", "WHAT%3F", "WHAT%3F"},
+		{"$SYS", "%24SYS", "$SYS"},
+		{"CON.SR", "CON.SR", "%43ON.SR"},
+		{"CONFIG", "CONFIG", "CONFIG"},
+		{"END.", "END.", "END%2E"},
+	}
+	for _, tt := range tests {
+		if got := escapeName(tt.name); got != tt.escaped {
+			t.Errorf("escape %s: expected %s, got %s", tt.name, tt.escaped, got)
+		}
+		if got := windowsName(tt.name); got != tt.windows {
+			t.Errorf("windows %s: expected %s, got %s", tt.name, tt.windows, got)
+		}
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("UDD").
+		file(68, "Q?", dataBlock{0, []byte("FIRST")}).
+		file(68, "q?", dataBlock{0, []byte("SECOND")}).
+		link("LNK", "UDD:Q?").
+		end().
+		bytes()
+
+	nameMapFile = filepath.Join(t.TempDir(), "NAMES.TSV")
+	if err := parseNamePolicy("lower"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { nameMapFile, mapName = "", namePolicies["upper"] }()
+	if err := openNameMap(); err != nil {
+		t.Fatal(err)
+	}
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"udd":      "/",
+		"udd/q?":   "FIRST",
+		"udd/q?~1": "SECOND",
+		"udd/lnk":  "->udd/q?",
+	})
+	nameMap, err := os.ReadFile(nameMapFile)
+	want := "udd\tUDD\nudd/q?\tUDD:Q?\nudd/q?~1\tUDD:q?\nudd/lnk\tUDD:LNK\n"
+	if err != nil || string(nameMap) != want {
+		t.Errorf("Name map mismatch, %v\nexpected:\n%s\ngot:\n%s", err, want, nameMap)
+	}
+}
+
+func TestLinksFollowRenames(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("UDD").
+		file(68, "Q?", dataBlock{0, []byte("FIRST")}).
+		file(68, "q?", dataBlock{0, []byte("SECOND")}).
+		link("REL", "q?").
+		link("ABS", ":UDD:q?").
+		end().
+		bytes()
+
+	if err := parseNamePolicy("lower"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { mapName = namePolicies["upper"] }()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"udd":      "/",
+		"udd/q?":   "FIRST",
+		"udd/q?~1": "SECOND",
+		"udd/rel":  "->q?~1",
+		"udd/abs":  "->q?~1",
+	})
+}
+
+func TestHostNamesPerDump(t *testing.T) {
+	dump := newDumpBuilder(t).
+		dir("UDD").
+		file(68, "A", dataBlock{0, []byte("A")}).
+		end().
+		bytes()
+
+	// tapes load each of their dumps in turn into the same directory
+	out, _ := runLoader(t, false, func() {
+		loadDump(bytes.NewReader(dump), "TEST.DMP")
+		loadDump(bytes.NewReader(dump), "TEST.DMP")
+	})
+	if strings.Contains(out, "~1") {
+		t.Errorf("Expected the second dump to be named afresh, got:\n%s", out)
+	}
+}
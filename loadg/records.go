@@ -0,0 +1,111 @@
+// records.go - record-format-aware extraction for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+var (
+	recordsFormat string
+	recordOut     *dumpfmt.RecordWriter // splitting the current file into records, if it is being converted
+)
+
+func parseRecordsFormat(format string) error {
+	switch format {
+	case "", "text", "jsonl", "binary":
+		return nil
+	}
+	return fmt.Errorf("unknown records format <%s>, expected text, jsonl or binary", format)
+}
+
+// recordEncoder writes each record of a file in the -records format
+type recordEncoder struct {
+	w      io.Writer
+	format string
+	count  int
+	buf    []byte
+}
+
+// recordLine is a record in the jsonl format, the bytes of the record are taken to be ISO 8859-1
+// so that any record, including binary data, is represented exactly
+type recordLine struct {
+	Record int    `json:"record"`
+	Length int    `json:"length"`
+	Data   string `json:"data"`
+}
+
+func (re *recordEncoder) write(rec []byte) error {
+	re.count++
+	switch re.format {
+	case "text":
+		re.buf = append(append(re.buf[:0], rec...), '\n')
+	case "jsonl":
+		js, err := json.Marshal(recordLine{Record: re.count, Length: len(rec), Data: string(appendLatin1(nil, rec))})
+		if err != nil {
+			return err
+		}
+		re.buf = append(js, '\n')
+	case "binary":
+		// a 4-byte big-endian length precedes each record
+		re.buf = binary.BigEndian.AppendUint32(re.buf[:0], uint32(len(rec)))
+		re.buf = append(re.buf, rec...)
+	}
+	_, err := re.w.Write(re.buf)
+	return err
+}
+
+// convertFilter returns the writer for the contents of a file, converting them if -text or -records applies.
+// Text files are converted by -text in preference to -records, programs are never converted.
+func convertFilter(w io.Writer, fs dumpfmt.Fstat, name string) io.Writer {
+	recordOut = nil
+	var emit func(rec []byte) error
+	switch {
+	case convertText && isText(fs, name):
+		if fs.RecordFormat == dumpfmt.RecFmtDynamic || fs.RecordFormat == dumpfmt.RecFmtUndefined {
+			// text with no record structure is split into lines
+			fs.RecordFormat = dumpfmt.RecFmtDataSensitive
+		}
+		emit = (&textWriter{w: w, fixed: fs.RecordFormat == dumpfmt.RecFmtFixed}).writeLine
+	case recordsFormat != "" && !isProgram(fs.EntryType):
+		emit = (&recordEncoder{w: w, format: recordsFormat}).write
+	default:
+		return w
+	}
+	recordOut = dumpfmt.NewRecordWriter(fs, emit)
+	return recordOut
+}
+
+// endConversion writes any incomplete last record of the current file if it was being converted
+func endConversion() error {
+	if recordOut == nil {
+		return nil
+	}
+	rw := recordOut
+	recordOut = nil
+	return rw.Close()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestRecordsFormats(t *testing.T) {
+	dump := newDumpBuilder(t).
+		fstatFile(dumpfmt.Fstat{EntryType: 64, RecordFormat: dumpfmt.RecFmtFixed, RecordLength: 3}, "FIXED", dataBlock{0, []byte("AB\xffCDE")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 64, RecordFormat: dumpfmt.RecFmtVariable}, "VAR", dataBlock{0, []byte("0006AB0005C")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 64, RecordFormat: dumpfmt.RecFmtUndefined}, "UNDEF", dataBlock{0, []byte("A\nB")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 87}, "PROG.PR", dataBlock{0, []byte("A\nB")}).
+		bytes()
+
+	tests := []struct {
+		format string
+		want   map[string]string
+	}{
+		{"text", map[string]string{"FIXED": "AB\xff\nCDE\n", "VAR": "AB\nC\n", "UNDEF": "A\nB\n", "PROG.PR": "A\nB"}},
+		{"jsonl", map[string]string{
+			"FIXED":   `{"record":1,"length":3,"data":"ABÿ"}` + "\n" + `{"record":2,"length":3,"data":"CDE"}` + "\n",
+			"VAR":     `{"record":1,"length":2,"data":"AB"}` + "\n" + `{"record":2,"length":1,"data":"C"}` + "\n",
+			"UNDEF":   `{"record":1,"length":3,"data":"A\nB"}` + "\n",
+			"PROG.PR": "A\nB",
+		}},
+		{"binary", map[string]string{
+			"FIXED":   "\x00\x00\x00\x03AB\xff\x00\x00\x00\x03CDE",
+			"VAR":     "\x00\x00\x00\x02AB\x00\x00\x00\x01C",
+			"UNDEF":   "\x00\x00\x00\x03A\nB",
+			"PROG.PR": "A\nB",
+		}},
+	}
+	defer func() { recordsFormat = "" }()
+	for _, tt := range tests {
+		recordsFormat = tt.format
+		_, base := runLoadg(t, dump, true)
+		compareTrees(t, extractedTree(t, base), tt.want)
+	}
+}
@@ -0,0 +1,96 @@
+// recover.go - best-effort recovery from damaged dumps for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// partialSuffix is added to the names of files that were damaged in the dump
+const partialSuffix = ".partial"
+
+var recoverDamage bool
+
+// resync skips over damage found by the dump reader to the next plausible entry, it returns
+// false if the rest of the dump had to be abandoned
+func resync(rdr *dumpfmt.Reader, err error) bool {
+	var fe *dumpfmt.FormatError
+	isFormatError := errors.As(err, &fe)
+	if isFormatError {
+		err = fmt.Errorf("%v%s", err, volumeNote(fe.Offset))
+	}
+	if !recoverDamage || !isFormatError {
+		log.Fatalf("ERROR: %v.  Giving up.", err)
+	}
+	log.Printf("ERROR: %v", err)
+	abandonFile()
+	next, err := rdr.Resync(fe.Offset)
+	if err == io.EOF {
+		log.Printf("WARNING: No further entries found, skipped from byte %d to the end of the dump", fe.Offset)
+		processRecord(&dumpfmt.EndOfDump{RecordHeader: dumpfmt.RecordHeader{RecordType: dumpfmt.EndDumpType}})
+		return false
+	}
+	if err != nil {
+		log.Fatalf("ERROR: Could not recover due to %v", err)
+	}
+	log.Printf("WARNING: Skipped damaged bytes %d to %d, resuming at the next entry", fe.Offset, next-1)
+	return true
+}
+
+// abandonFile finishes any file being loaded when the dump was damaged, marking it as partially recovered
+func abandonFile() {
+	if !inFile && !writing {
+		return
+	}
+	if writing {
+		if err := endConversion(); err != nil {
+			log.Printf("ERROR: Could not write out data due to %v", err)
+		}
+	}
+	if writing && arch != nil {
+		if archPending != nil {
+			// only honoured by tar, zip has already written the name
+			archPending.path += partialSuffix
+		}
+		checkArchive(arch.endFile())
+	} else if writing {
+		writeFile.Close()
+		if err := os.Rename(writePath, writePath+partialSuffix); err != nil {
+			log.Printf("ERROR: Could not rename partial file %s due to %v", writePath, err)
+		}
+	}
+	if entrySelected {
+		log.Printf("WARNING: %s was only partially recovered (%d bytes)", entryPath, totalFileSize)
+		if summary {
+			fmt.Printf(" %12d bytes (partial)\n", totalFileSize)
+		}
+	}
+	writing, inFile = false, false
+	totalFileSize = 0
+	fileHashes = nil // partial files are not in the manifest
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestRecovery(t *testing.T) {
+	db := newDumpBuilder(t).
+		file(68, "BEFORE", dataBlock{0, []byte("OK")})
+	db.header(68, "DAMAGED")
+	db.check(db.dw.WriteStartBlock())
+	db.check(db.dw.WriteDataBlock(0, []byte("GOOD")))
+	damageAt := db.buf.Len()
+	db.check(db.dw.WriteDataBlock(4, []byte("LOST")))
+	db.end().
+		dir("D").
+		file(64, "AFTER", dataBlock{0, []byte("SAVED")}).
+		end()
+	dump := db.bytes()
+	dump[damageAt] = 42 << 2 // an unknown record type
+
+	recoverDamage = true
+	defer func() { recoverDamage = false }()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"BEFORE":          "OK",
+		"DAMAGED.partial": "GOOD",
+		"D":               "/",
+		"D/AFTER":         "SAVED",
+	})
+
+	// nothing plausible after the damage
+	truncated := newDumpBuilder(t).file(68, "F", dataBlock{0, []byte("DATA")}).bytes()
+	runLoader(t, false, func() {
+		rdr := dumpfmt.NewReader(bytes.NewReader(truncated[:len(truncated)-3]))
+		for {
+			if _, err := rdr.Next(); err != nil {
+				if resync(rdr, err) {
+					t.Error("Expected resynchronisation to fail on a truncated dump")
+				}
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// select.go - selection of dump entries by AOS/VS template or glob for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A pattern selects entries by their path relative to the root of the dump.
+//
+// Patterns containing ':', '+', '#' or '^' are AOS/VS templates using ':' to separate
+// directories, where '+' matches any characters, '-' any characters except a period,
+// '*' any single character except a period, '#' any number of directory levels
+// and '^' the parent directory.  All other patterns are globs using '/' separators
+// where a "**" component matches any number of directory levels.
+// A pattern with no separators is matched against the entry name at any level.
+// Matching is not case-sensitive.
+type pattern struct {
+	src        string
+	components []componentMatcher
+}
+
+// componentMatcher matches one path component, or any number of them if anyDepth
+type componentMatcher struct {
+	anyDepth bool
+	match    func(name string) bool
+}
+
+// patternList is a repeatable flag.Value
+type patternList []*pattern
+
+func (pl *patternList) String() string {
+	strs := make([]string, len(*pl))
+	for i, p := range *pl {
+		strs[i] = p.src
+	}
+	return strings.Join(strs, ",")
+}
+
+func (pl *patternList) Set(s string) error {
+	p, err := compilePattern(s)
+	if err != nil {
+		return err
+	}
+	*pl = append(*pl, p)
+	return nil
+}
+
+var includes, excludes patternList
+
+func isTemplate(s string) bool {
+	return strings.ContainsAny(s, ":+#^")
+}
+
+func compilePattern(s string) (*pattern, error) {
+	p := &pattern{src: s}
+	var parts []string
+	template := isTemplate(s)
+	if template {
+		parts = strings.Split(strings.TrimPrefix(s, ":"), ":")
+	} else {
+		parts = strings.Split(strings.TrimPrefix(s, "/"), "/")
+	}
+	if len(parts) == 1 && !strings.HasPrefix(s, ":") && !strings.HasPrefix(s, "/") && parts[0] != "#" && parts[0] != "**" {
+		// unanchored name - match at any level
+		p.components = append(p.components, componentMatcher{anyDepth: true})
+	}
+	for _, part := range parts {
+		switch {
+		case part == "" || part == "=" || part == ".":
+			continue
+		case template && part == "^", !template && part == "..":
+			if len(p.components) > 0 {
+				p.components = p.components[:len(p.components)-1]
+			}
+		case template && part == "#", !template && part == "**":
+			p.components = append(p.components, componentMatcher{anyDepth: true})
+		case template:
+			re, err := templateRegexp(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template <%s> due to %v", s, err)
+			}
+			p.components = append(p.components, componentMatcher{match: re.MatchString})
+		default:
+			glob := strings.ToUpper(part)
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern <%s> due to %v", s, err)
+			}
+			p.components = append(p.components, componentMatcher{match: func(name string) bool {
+				matched, _ := path.Match(glob, strings.ToUpper(name))
+				return matched
+			}})
+		}
+	}
+	return p, nil
+}
+
+// templateRegexp converts one component of an AOS/VS template to a regular expression
+func templateRegexp(tmpl string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for _, r := range tmpl {
+		switch r {
+		case '+':
+			sb.WriteString(".*")
+		case '-':
+			sb.WriteString(`[^.]*`)
+		case '*':
+			sb.WriteString(`[^.]`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// matches reports whether the pattern matches the '/'-separated path exactly
+func (p *pattern) matches(relPath string) bool {
+	return matchComponents(p.components, strings.Split(relPath, "/"))
+}
+
+func matchComponents(pats []componentMatcher, names []string) bool {
+	if len(pats) == 0 {
+		return len(names) == 0
+	}
+	if pats[0].anyDepth {
+		for skip := 0; skip <= len(names); skip++ {
+			if matchComponents(pats[1:], names[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 || !pats[0].match(names[0]) {
+		return false
+	}
+	return matchComponents(pats[1:], names[1:])
+}
+
+// matchesPathOrParent reports whether any pattern matches the path or one of the directories containing it
+func (pl patternList) matchesPathOrParent(relPath string) bool {
+	for p := relPath; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pat := range pl {
+			if pat.matches(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selected reports whether an entry should be listed and extracted given the -include and -exclude patterns
+func selected(relPath string) bool {
+	if len(includes) > 0 && !includes.matchesPathOrParent(relPath) {
+		return false
+	}
+	return !excludes.matchesPathOrParent(relPath)
+}
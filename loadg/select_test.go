@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestPatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"+.CLI", "UDD/SMERRONY/UP.CLI", true},
+		{"+.CLI", "UDD/SMERRONY/UP.CLI.BAK", false},
+		{"UDD:+", "UDD/SMERRONY", true},
+		{"UDD:+", "UDD/SMERRONY/UP.CLI", false},
+		{":UDD:#:+.SR", "UDD/SMERRONY/SRC/MAIN.SR", true},
+		{":UDD:#:+.SR", "UDD/MAIN.SR", true},
+		{":UDD:#:+.SR", "UTIL/MAIN.SR", false},
+		{"UDD:SMERRONY:^:FRED:-", "UDD/FRED/UP.CLI", false},
+		{"UDD:SMERRONY:^:FRED:-", "UDD/FRED/UP", true},
+		{"UDD:X:**.CLI", "UDD/X/AB.CLI", true},
+		{"UDD:X:**.CLI", "UDD/X/ABC.CLI", false},
+		{"udd/*/*.cli", "UDD/SMERRONY/UP.CLI", true},
+		{"UDD/**/*.SR", "UDD/A/B/C.SR", true},
+		{"UDD/*.SR", "UDD/A/C.SR", false},
+	}
+	for _, tt := range tests {
+		p, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("Could not compile %s due to %v", tt.pattern, err)
+		}
+		if got := p.matches(tt.path); got != tt.want {
+			t.Errorf("Pattern %s against %s: expected %v, got %v", tt.pattern, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestSelected(t *testing.T) {
+	includes, excludes = nil, nil
+	defer func() { includes, excludes = nil, nil }()
+	includes.Set("UDD:SMERRONY")
+	excludes.Set("+.OB")
+	for path, want := range map[string]bool{
+		"UDD/SMERRONY":          true,
+		"UDD/SMERRONY/SRC/A.SR": true,
+		"UDD/SMERRONY/A.OB":     false,
+		"UDD/FRED/A.SR":         false,
+	} {
+		if got := selected(path); got != want {
+			t.Errorf("Path %s: expected %v, got %v", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// tape.go - loading dumps from SIMH/E11 tape images for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+	"github.com/SMerrony/aosvs-tools/simhtape"
+)
+
+var (
+	tapeImage bool
+	tapeFile  int
+)
+
+// loadTape lists, extracts or verifies each dump found on the tape image, or only the file
+// selected by -tapeFile.  It returns false if verification failed.
+func loadTape(r io.Reader, tapeName string) bool {
+	tr := simhtape.NewReader(r)
+	passed, found := true, false
+	for {
+		tf, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if tapeFile != 0 && tf.Number != tapeFile {
+			continue
+		}
+		found = true
+		if summary || verbose || verify {
+			fmt.Printf("=== Tape file %d ===\n", tf.Number)
+		}
+		br := bufio.NewReader(tf)
+		isDump := looksLikeDump(br)
+		switch {
+		case !isDump:
+		case verify:
+			passed = verifyDump(br, fmt.Sprintf("%s file %d", tapeName, tf.Number)) && passed
+		default:
+			loadDump(br, fmt.Sprintf("%s file %d", tapeName, tf.Number))
+		}
+		// read the rest of the file so that it is all counted
+		if _, err = io.Copy(io.Discard, br); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		if summary || verbose || verify {
+			desc := "not a dump"
+			if isDump {
+				desc = "dump"
+			}
+			fmt.Printf("Tape file %d: %s, %d records, %d bytes\n", tf.Number, desc, tf.Records, tf.Bytes)
+		}
+		if tf.BadRecords > 0 {
+			log.Printf("WARNING: Tape file %d has %d record(s) flagged as read with errors", tf.Number, tf.BadRecords)
+		}
+	}
+	if !found {
+		log.Fatalf("ERROR: Tape file %d not found on %s", tapeFile, tapeName)
+	}
+	return passed
+}
+
+// isTape reports whether the named dump is to be read as a tape image
+func isTape(name string) bool {
+	return tapeImage || strings.EqualFold(filepath.Ext(trimCompressionExt(name)), ".tap")
+}
+
+// looksLikeDump reports whether the data starts with a Start Of Dump record
+func looksLikeDump(br *bufio.Reader) bool {
+	hdr, err := br.Peek(2)
+	return err == nil && int(hdr[0])>>2 == dumpfmt.StartDumpType && int(hdr[0]&0x03)<<8+int(hdr[1]) == 14
+}
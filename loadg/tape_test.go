@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// makeTapeImage writes each file as 100-byte tape records in SIMH format, followed by tape marks
+func makeTapeImage(files ...[]byte) []byte {
+	var buf bytes.Buffer
+	word := func(w int) { binary.Write(&buf, binary.LittleEndian, uint32(w)) }
+	for _, f := range files {
+		for len(f) > 0 {
+			rec := f
+			if len(rec) > 100 {
+				rec = rec[:100]
+			}
+			word(len(rec))
+			buf.Write(rec)
+			if len(rec)%2 != 0 {
+				buf.WriteByte(0)
+			}
+			word(len(rec))
+			f = f[len(rec):]
+		}
+		word(0)
+	}
+	word(0)
+	return buf.Bytes()
+}
+
+func TestTape(t *testing.T) {
+	dump := sampleDump(t)
+	tape := makeTapeImage([]byte("VOLUME LABEL"), dump)
+	out, base := runLoader(t, true, func() { loadTape(bytes.NewReader(tape), "TEST.TAP") })
+	for _, want := range []string{
+		"=== Tape file 1 ===\nTape file 1: not a dump, 1 records, 12 bytes\n",
+		"=== Tape file 2 ===\nSummary of dump file : TEST.TAP file 2\n",
+		"=== End of Dump ===\nTape file 2: dump, ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+	if tree := extractedTree(t, base); tree["UDD/SRC/HELLO.TXT"] != "HELLO\nWORLD\n" {
+		t.Errorf("Dump on tape was not extracted, got %v", tree)
+	}
+}
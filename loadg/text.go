@@ -0,0 +1,90 @@
+// text.go - conversion of AOS/VS text files to host conventions for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+var (
+	convertText bool
+	textExts    string
+)
+
+// hostEOL is the line ending written after each record of a converted text file
+var hostEOL = func() string {
+	if runtime.GOOS == "windows" {
+		return "\r\n"
+	}
+	return "\n"
+}()
+
+// isText reports whether the entry should be converted by -text, ie. it is an FTXT file
+// or its name has one of the -textExt extensions
+func isText(fs dumpfmt.Fstat, name string) bool {
+	if et, known := dumpfmt.KnownFstatEntryTypes[fs.EntryType]; known && et.DgMnemonic == "FTXT" {
+		return true
+	}
+	ext := path.Ext(name)
+	if ext == "" {
+		return false
+	}
+	for _, e := range strings.Split(textExts, ",") {
+		if strings.EqualFold(strings.TrimSpace(e), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// textWriter writes each record of a text file as a line of UTF-8 with the host line ending
+type textWriter struct {
+	w     io.Writer
+	fixed bool
+	line  []byte
+}
+
+// writeLine converts a record, characters above 0177 are taken to be ISO 8859-1
+func (tw *textWriter) writeLine(rec []byte) error {
+	if tw.fixed {
+		// fixed-length records are padded
+		rec = []byte(strings.TrimRight(string(rec), " \x00"))
+	}
+	tw.line = appendLatin1(tw.line[:0], rec)
+	tw.line = append(tw.line, hostEOL...)
+	_, err := tw.w.Write(tw.line)
+	return err
+}
+
+// appendLatin1 appends the ISO 8859-1 bytes b to dst as UTF-8
+func appendLatin1(dst, b []byte) []byte {
+	for _, c := range b {
+		dst = utf8.AppendRune(dst, rune(c))
+	}
+	return dst
+}
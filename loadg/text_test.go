@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestTextConversion(t *testing.T) {
+	dump := newDumpBuilder(t).
+		fstatFile(dumpfmt.Fstat{EntryType: 68, RecordFormat: dumpfmt.RecFmtDataSensitive}, "NOTES", dataBlock{0, []byte("CAF\xc9\r\nPAGE\f")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 68, RecordFormat: dumpfmt.RecFmtFixed, RecordLength: 6}, "CARDS", dataBlock{0, []byte("ONE   TWO   ")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 64, RecordFormat: dumpfmt.RecFmtVariable}, "PROG.SR", dataBlock{0, []byte("0008LDA 0009STA 1")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 64}, "DATA", dataBlock{0, []byte("A\r\nB")}).
+		bytes()
+
+	convertText, textExts = true, ".cli,.sr"
+	defer func() { convertText, textExts = false, "" }()
+	_, base := runLoadg(t, dump, true)
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"NOTES":   "CAFÉ" + hostEOL + "PAGE\f" + hostEOL,
+		"CARDS":   "ONE" + hostEOL + "TWO" + hostEOL,
+		"PROG.SR": "LDA " + hostEOL + "STA 1" + hostEOL,
+		"DATA":    "A\r\nB",
+	})
+}
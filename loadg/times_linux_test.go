@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestRestoreTimes(t *testing.T) {
+	modified := time.Date(1994, 7, 21, 9, 30, 14, 0, time.UTC)
+	accessed := time.Date(1995, 1, 2, 3, 4, 4, 0, time.UTC)
+	db := newDumpBuilder(t)
+	db.fstatHeader(dumpfmt.Fstat{EntryType: 10, Modified: modified, Accessed: accessed}, "D")
+	dump := db.
+		fstatFile(dumpfmt.Fstat{EntryType: 64, Modified: modified, Accessed: accessed}, "F", dataBlock{0, []byte("F")}).
+		fstatFile(dumpfmt.Fstat{EntryType: 64, Modified: modified}, "NOACCESS", dataBlock{0, []byte("N")}).
+		end().
+		bytes()
+	// AOS/VS times have no zone so are restored as the same wall-clock time here (FSTAT times are to 2 seconds)
+	wantM := time.Date(1994, 7, 21, 9, 30, 14, 0, time.Local)
+	wantA := time.Date(1995, 1, 2, 3, 4, 4, 0, time.Local)
+	if got := hostTime(modified); !got.Equal(wantM) {
+		t.Errorf("Expected host time %v, got %v", wantM, got)
+	}
+	tests := []struct {
+		noTimes bool
+		path    string
+		mtime   time.Time
+		atime   time.Time
+	}{
+		{false, "D", wantM, wantA}, // set when the directory is complete, after its contents are written
+		{false, "D/F", wantM, wantA},
+		{false, "D/NOACCESS", wantM, wantM},
+		{true, "D", time.Time{}, time.Time{}},
+		{true, "D/F", time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		start := time.Now().Add(-time.Minute)
+		_, base := runLoader(t, true, func() {
+			noTimes = tt.noTimes
+			loadDump(bytes.NewReader(dump), "TEST.DMP")
+		})
+		info, err := os.Stat(filepath.Join(base, tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		atime := time.Unix(info.Sys().(*syscall.Stat_t).Atim.Unix())
+		if tt.noTimes {
+			if info.ModTime().Before(start) {
+				t.Errorf("%s: expected the time of extraction with -noTimes, got %v", tt.path, info.ModTime())
+			}
+			continue
+		}
+		if !info.ModTime().Equal(tt.mtime) || !atime.Equal(tt.atime) {
+			t.Errorf("%s: expected modified %v accessed %v, got %v and %v", tt.path, tt.mtime, tt.atime, info.ModTime(), atime)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// uda.go - display and preservation of AOS/VS User Data Areas for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+const (
+	udaSidecarSuffix = ".aosvs.uda"
+	udaXattrName     = "user.aosvs.uda"
+)
+
+// ways in which UDAs may be preserved on extraction, set via the -uda option
+var udaSidecar, udaXattr bool
+
+func parseUDAOpts(opts string) error {
+	if opts == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		switch opt {
+		case "sidecar":
+			udaSidecar = true
+		case "xattr":
+			udaXattr = true
+		default:
+			return fmt.Errorf("unknown UDA option <%s>, expected sidecar and/or xattr", opt)
+		}
+	}
+	return nil
+}
+
+func processUDA(uda *dumpfmt.UDA) {
+	if verbose {
+		showUDA(uda.UDA)
+	}
+	if arch != nil && archPending != nil {
+		archPending.uda = uda.UDA
+	}
+	if !extract || !entrySelected {
+		return
+	}
+	if udaSidecar {
+		if err := writeNewFile(entryPath+udaSidecarSuffix, uda.UDA); err != nil {
+			log.Printf("ERROR: Could not write UDA file for %s due to %v", entryPath, err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+		}
+	}
+	// the file or directory has already been created, but links have not
+	if udaXattr && (entryIsDir || writing) {
+		if err := setXattr(entryPath, udaXattrName, uda.UDA); err != nil {
+			log.Printf("ERROR: Could not set %s attribute on %s due to %v", udaXattrName, entryPath, err)
+			if !ignoreErrors {
+				log.Fatalln("Giving up.")
+			}
+		}
+	}
+}
+
+// showUDA displays the UDA in hex and ASCII, trailing NULLs are not shown
+func showUDA(uda []byte) {
+	used := bytes.TrimRight(uda, "\x00")
+	fmt.Printf(" UDA: %d bytes, %d in use\n", len(uda), len(used))
+	if len(used) == 0 {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(hex.Dump(used), "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUDA(t *testing.T) {
+	uda := make([]byte, 256)
+	copy(uda, "HELLO, UDA\x01")
+	db := newDumpBuilder(t)
+	db.header(64, "F")
+	db.check(db.dw.WriteUDA(uda))
+	db.check(db.dw.WriteStartBlock())
+	db.check(db.dw.WriteDataBlock(0, []byte("DATA")))
+	dump := db.end().bytes()
+
+	udaSidecar = true
+	defer func() { udaSidecar = false }()
+	out, base := runLoader(t, true, func() {
+		verbose = true
+		loadDump(bytes.NewReader(dump), "TEST.DMP")
+	})
+	compareTrees(t, extractedTree(t, base), map[string]string{
+		"F":                    "DATA",
+		"F" + udaSidecarSuffix: string(uda),
+	})
+	want := " UDA: 256 bytes, 11 in use\n" +
+		"  00000000  48 45 4c 4c 4f 2c 20 55  44 41 01                 |HELLO, UDA.|\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("Expected UDA display\n%s\ngot:\n%s", want, out)
+	}
+}
@@ -0,0 +1,199 @@
+// verify.go - integrity checking of dumps for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+var verify bool
+
+// verifier holds the state of the dump structure while it is checked
+type verifier struct {
+	problems int
+	warnings int          // of records unlike those of the dumps seen so far, which do not fail verification
+	fsb      *dumpfmt.FSB // the FSB awaiting its name block
+	entry    string       // path of the current entry, for messages
+	dirs     []string     // directories entered, innermost last
+	inHeader bool         // between the name block and the contents of an entry, where UDA, ACL and link records belong
+	inFile   bool
+	nextAddr int64 // the lowest byte address expected in the next data block
+}
+
+func (v *verifier) problem(offset int64, format string, a ...interface{}) {
+	v.problems++
+	msg := fmt.Sprintf(format, a...)
+	if v.entry != "" {
+		msg += " in " + v.entry
+	}
+	fmt.Printf("Offset %d%s: %s\n", offset, volumeNote(offset), msg)
+}
+
+// warning reports something unusual which may nevertheless be legal
+func (v *verifier) warning(offset int64, format string, a ...interface{}) {
+	v.warnings++
+	msg := fmt.Sprintf(format, a...)
+	if v.entry != "" {
+		msg += " in " + v.entry
+	}
+	fmt.Printf("Offset %d%s: WARNING: %s\n", offset, volumeNote(offset), msg)
+}
+
+// verifyDump checks the structure of the whole dump without extracting anything, it returns true if no problems were found
+func verifyDump(dumpFile io.Reader, dumpName string) bool {
+	v := &verifier{}
+	rdr := dumpfmt.NewReader(dumpFile)
+	rdr.SkipData(true)
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var fe *dumpfmt.FormatError
+			if errors.As(err, &fe) && errors.Is(err, dumpfmt.ErrTruncated) && fe.RecordType == dumpfmt.NoRecordType && rdr.SOD() != nil {
+				v.problem(fe.Offset, "dump is unterminated, no End of Dump record")
+			} else if errors.As(err, &fe) {
+				msg := fe.Err.Error()
+				if fe.Detail != "" {
+					msg += " - " + fe.Detail
+				}
+				v.problem(fe.Offset, "%s", msg)
+			} else {
+				v.problem(rdr.Offset(), "%v", err)
+			}
+			break
+		}
+		v.check(rec)
+	}
+	if v.problems == 0 {
+		if v.warnings > 0 {
+			fmt.Printf("%s: PASS, %d warning(s)\n", dumpName, v.warnings)
+		} else {
+			fmt.Printf("%s: PASS\n", dumpName)
+		}
+		return true
+	}
+	fmt.Printf("%s: FAIL, %d problem(s) found\n", dumpName, v.problems)
+	return false
+}
+
+func (v *verifier) check(rec dumpfmt.Record) {
+	hdr := rec.Header()
+	switch r := rec.(type) {
+	case *dumpfmt.SOD:
+	case *dumpfmt.FSB:
+		if v.inFile {
+			v.problem(hdr.Offset, "file has no end block")
+			v.inFile = false
+		}
+		if v.fsb != nil {
+			v.problem(v.fsb.Offset, "FSB has no name block")
+		}
+		v.fsb = r
+		v.entry = ""
+		v.inHeader = false
+		if len(r.Blob) < dumpfmt.FstatPacketBytes {
+			v.problem(hdr.Offset, "FSB too short (%d bytes, expected %d)", len(r.Blob), dumpfmt.FstatPacketBytes)
+		} else if len(r.Blob) > dumpfmt.FstatPacketBytes {
+			v.warning(hdr.Offset, "FSB longer than usual (%d bytes, usually %d)", len(r.Blob), dumpfmt.FstatPacketBytes)
+		}
+		if _, known := dumpfmt.KnownFstatEntryTypes[r.EntryType()]; !known {
+			v.problem(hdr.Offset, "unknown FSTAT entry type %d", r.EntryType())
+		}
+	case *dumpfmt.NameBlock:
+		if v.fsb == nil {
+			v.problem(hdr.Offset, "name block %s without an FSB", r.FileName)
+			return
+		}
+		dir := "."
+		if len(v.dirs) > 0 {
+			dir = v.dirs[len(v.dirs)-1]
+		}
+		v.entry = path.Join(dir, r.FileName)
+		if r.FileName == "" {
+			v.problem(hdr.Offset, "empty name")
+		}
+		if len(r.FileName) > dumpfmt.MaxNameLength {
+			v.problem(hdr.Offset, "name longer than %d characters", dumpfmt.MaxNameLength)
+		} else if hdr.RecordLength > dumpfmt.MaxNameBlockBytes {
+			v.warning(hdr.Offset, "name block longer than usual (%d bytes)", hdr.RecordLength)
+		}
+		if et, known := dumpfmt.KnownFstatEntryTypes[v.fsb.EntryType()]; known && et.IsDir {
+			v.dirs = append(v.dirs, v.entry)
+		}
+		v.fsb = nil
+		v.inHeader = true
+	case *dumpfmt.UDA, *dumpfmt.ACL, *dumpfmt.Link:
+		if !v.inHeader {
+			v.problem(hdr.Offset, "record of type %d outside an entry header", hdr.RecordType)
+		}
+		if hdr.RecordType == dumpfmt.LinkType {
+			v.inHeader = false
+		}
+		if uda, isUDA := r.(*dumpfmt.UDA); isUDA && len(uda.UDA) != dumpfmt.UDABytes {
+			v.warning(hdr.Offset, "UDA of unusual length %d, usually %d", len(uda.UDA), dumpfmt.UDABytes)
+		}
+	case *dumpfmt.StartBlock:
+		if v.inFile {
+			v.problem(hdr.Offset, "nested start block")
+		}
+		if hdr.RecordLength != 0 {
+			v.problem(hdr.Offset, "start block has impossible length %d", hdr.RecordLength)
+		}
+		v.inFile = true
+		v.inHeader = false
+		v.nextAddr = 0
+	case *dumpfmt.DataBlock:
+		if !v.inFile {
+			v.problem(hdr.Offset, "data block outside a file")
+		}
+		if hdr.RecordLength != dumpfmt.DataHeaderBytes {
+			v.warning(hdr.Offset, "data block header of unusual length %d, usually %d", hdr.RecordLength, dumpfmt.DataHeaderBytes)
+		}
+		if int64(r.ByteAddress) < v.nextAddr {
+			v.problem(hdr.Offset, "block address goes backwards from %d to %d", v.nextAddr, r.ByteAddress)
+		}
+		v.nextAddr = int64(r.ByteAddress) + int64(r.ByteLength)
+	case *dumpfmt.EndBlock:
+		if hdr.RecordLength != 0 {
+			v.problem(hdr.Offset, "end block has impossible length %d", hdr.RecordLength)
+		}
+		if v.inFile {
+			v.inFile = false
+		} else if len(v.dirs) > 0 {
+			// dumps may legally contain 'too many' directory pops
+			v.dirs = v.dirs[:len(v.dirs)-1]
+		}
+		v.entry = ""
+		v.inHeader = false
+	case *dumpfmt.EndOfDump:
+		if v.inFile {
+			v.problem(hdr.Offset, "dump ends within a file")
+		}
+	}
+}
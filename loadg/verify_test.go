@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// raw appends a record which dumpfmt.Writer would not write
+func (db *dumpBuilder) raw(recType int, body []byte) *dumpBuilder {
+	db.buf.Write([]byte{byte(recType<<2 | len(body)>>8), byte(len(body))})
+	db.buf.Write(body)
+	return db
+}
+
+func TestVerify(t *testing.T) {
+	good := newDumpBuilder(t).dir("D").file(68, "F", dataBlock{0, []byte("AB")}, dataBlock{4, []byte("CD")}).end().bytes()
+	noEndBlock := newDumpBuilder(t)
+	noEndBlock.header(68, "F")
+	noEndBlock.check(noEndBlock.dw.WriteStartBlock())
+	strayData := newDumpBuilder(t).dir("D")
+	strayData.check(strayData.dw.WriteDataBlock(0, []byte("X")))
+	longFSB := make([]byte, dumpfmt.FstatPacketBytes+2)
+	longFSB[1] = 68
+	longFSBDump := newDumpBuilder(t).raw(dumpfmt.FSBType, longFSB)
+	longFSBDump.check(longFSBDump.dw.WriteName("F"))
+	longFSBDump.check(longFSBDump.dw.WriteStartBlock())
+	shortUDA := newDumpBuilder(t)
+	shortUDA.header(68, "F")
+	shortUDA.check(shortUDA.dw.WriteUDA(make([]byte, 10)))
+	paddedName := newDumpBuilder(t)
+	paddedName.check(paddedName.dw.WriteFSB(dumpfmt.Fstat{EntryType: 68}))
+	paddedName.raw(dumpfmt.NameBlockType, append([]byte("F"), make([]byte, 99)...))
+	shortDataHeader := newDumpBuilder(t)
+	shortDataHeader.header(68, "F")
+	shortDataHeader.check(shortDataHeader.dw.WriteStartBlock())
+	// the header claims 4 bytes but the usual 10 follow
+	shortDataHeader.buf.Write([]byte{dumpfmt.DataBlockType << 2, 4})
+	shortDataHeader.buf.Write(make([]byte, dumpfmt.DataHeaderBytes))
+	tests := []struct {
+		name string
+		dump []byte
+		want string // in the output, "" for a pass
+		pass bool   // despite want, which is then a warning
+	}{
+		{"good", good, "", true},
+		{"unterminated", good[:len(good)-2], "dump is unterminated", false},
+		{"truncated", good[:len(good)-8], "truncated record", false},
+		{"backwards", newDumpBuilder(t).file(68, "F", dataBlock{4, []byte("AB")}, dataBlock{0, []byte("CD")}).bytes(), "block address goes backwards from 6 to 0 in F", false},
+		{"no end block", noEndBlock.file(68, "G").bytes(), "file has no end block", false},
+		{"unknown type", newDumpBuilder(t).file(99, "F").bytes(), "unknown FSTAT entry type 99", false},
+		{"stray data", strayData.end().bytes(), "data block outside a file in D", false},
+		{"long FSB", longFSBDump.end().bytes(), "WARNING: FSB longer than usual (46 bytes, usually 44)", true},
+		{"short UDA", shortUDA.end().bytes(), "WARNING: UDA of unusual length 10, usually 256 in F", true},
+		{"long name", newDumpBuilder(t).file(68, strings.Repeat("N", 32)).bytes(), "name longer than 31 characters", false},
+		{"padded name", paddedName.end().bytes(), "WARNING: name block longer than usual (100 bytes) in F", true},
+		{"data header", shortDataHeader.end().bytes(), "WARNING: data block header of unusual length 4, usually 10 in F", true},
+	}
+	for _, tt := range tests {
+		var passed bool
+		out, _ := runLoader(t, false, func() { passed = verifyDump(bytes.NewReader(tt.dump), "TEST.DMP") })
+		if passed != tt.pass {
+			t.Errorf("%s: expected pass to be %v, output:\n%s", tt.name, tt.pass, out)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("%s: expected %q, got:\n%s", tt.name, tt.want, out)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// volumes.go - multi-volume dumps for loadg
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+// volumes is set when a multi-volume dump is being read
+var volumes *dumpfmt.Volumes
+
+// dumpVolumeNames returns the names of the volumes of the dump: the -dumpFile, which may be a glob,
+// followed by any further files named on the command line
+func dumpVolumeNames(dumpArg string, more []string) ([]string, error) {
+	names := []string{dumpArg}
+	if _, err := os.Stat(dumpArg); err != nil && strings.ContainsAny(dumpArg, "*?[") {
+		matches, err := filepath.Glob(dumpArg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no dump files match <%s>", dumpArg)
+		}
+		// so that eg. DUMP.10 follows DUMP.9
+		sort.Slice(matches, func(i, j int) bool { return naturalLess(matches[i], matches[j]) })
+		names = matches
+	}
+	return append(names, more...), nil
+}
+
+// naturalLess compares strings treating runs of digits as numbers
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		aDigits := len(a) - len(strings.TrimLeft(a, "0123456789"))
+		bDigits := len(b) - len(strings.TrimLeft(b, "0123456789"))
+		switch {
+		case aDigits > 0 && bDigits > 0:
+			an, bn := strings.TrimLeft(a[:aDigits], "0"), strings.TrimLeft(b[:bDigits], "0")
+			if len(an) != len(bn) {
+				return len(an) < len(bn)
+			}
+			if an != bn {
+				return an < bn
+			}
+			a, b = a[aDigits:], b[bDigits:]
+		case a[0] != b[0]:
+			return a[0] < b[0]
+		default:
+			a, b = a[1:], b[1:]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// openVolumes joins the volumes into one logical dump, closing them again if that fails
+func openVolumes(names []string) (vols *dumpfmt.Volumes, err error) {
+	var files []*os.File
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+		}
+	}()
+	var sections []*io.SectionReader
+	for _, name := range names {
+		if name == stdinName {
+			return nil, fmt.Errorf("stdin cannot be used for a multi-volume dump")
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open dump volume <%s> due to %v", name, err)
+		}
+		files = append(files, f)
+		magic := make([]byte, maxMagicLen)
+		n, _ := f.ReadAt(magic, 0)
+		if kind := compression(magic[:n]); kind != "" {
+			return nil, fmt.Errorf("dump volume <%s> is %s compressed, compressed dumps must be a single file", name, kind)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, io.NewSectionReader(f, 0, info.Size()))
+	}
+	vols, err = dumpfmt.JoinVolumes(sections...)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkVolumeOrder(vols, names); err != nil {
+		if !recoverDamage {
+			return nil, err
+		}
+		log.Printf("WARNING: %v", err)
+	}
+	if verbose {
+		for i, name := range names {
+			fmt.Printf("Volume %d: %s\n", i+1, name)
+		}
+	}
+	return vols, nil
+}
+
+// volumeNote describes where an offset in a multi-volume dump lies
+func volumeNote(offset int64) string {
+	if volumes == nil {
+		return ""
+	}
+	vol, volOffset := volumes.Locate(offset)
+	return fmt.Sprintf(" (volume %d, offset %d)", vol, volOffset)
+}
+
+// checkVolumeOrder reads the structure of the whole dump so that volumes given in the wrong order are
+// reported by name, rather than as an unrelated error part way through loading.
+// Damage within the first volume is left to be reported when the dump is loaded.
+func checkVolumeOrder(vols *dumpfmt.Volumes, names []string) error {
+	rdr := dumpfmt.NewReader(io.NewSectionReader(vols, 0, vols.Size()))
+	rdr.SkipData(true)
+	for {
+		_, err := rdr.Next()
+		if err == io.EOF {
+			if vol, _ := vols.Locate(rdr.Offset()); rdr.Offset() < vols.Size() && vol < len(names) {
+				return fmt.Errorf("%w: the dump ends in volume <%s>, before volume <%s>", dumpfmt.ErrVolumeSequence, names[vol-1], names[vol])
+			}
+			return nil
+		}
+		if err != nil {
+			vol := 1
+			var fe *dumpfmt.FormatError
+			if errors.As(err, &fe) {
+				vol, _ = vols.Locate(fe.Offset)
+			}
+			if readVol, _ := vols.Locate(rdr.Offset()); readVol > vol {
+				vol = readVol
+			}
+			if vol == 1 {
+				return nil
+			}
+			return fmt.Errorf("%w: %v, after the boundary between volumes <%s> and <%s>", dumpfmt.ErrVolumeSequence, err, names[vol-2], names[vol-1])
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SMerrony/aosvs-tools/dumpfmt"
+)
+
+func TestVolumeOrder(t *testing.T) {
+	dump := sampleDump(t)
+	dir := t.TempDir()
+	var names []string
+	third := len(dump) / 3
+	for i, part := range [][]byte{dump[:third], dump[third : 2*third], dump[2*third:]} {
+		name := filepath.Join(dir, "VOL.A"+string(rune('A'+i)))
+		if err := os.WriteFile(name, part, 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if _, err := openVolumes(names); err != nil {
+		t.Fatalf("Unexpected error opening volumes in order: %v", err)
+	}
+	_, err := openVolumes([]string{names[0], names[2], names[1]})
+	if !errors.Is(err, dumpfmt.ErrVolumeSequence) || !strings.Contains(err.Error(), "<"+names[0]+"> and <"+names[2]+">") {
+		t.Errorf("Expected the volumes to be reported out of order by name, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// simhtape.go - reading of SIMH and E11 magnetic tape image files
+
+// Copyright (C) 2018,2019  Steve Merrony
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package simhtape reads the tape images used by the SIMH and E11 emulators, where each tape
+// record is preceded and followed by its length as a 4-byte little-endian word and a tape mark
+// is a zero length word.  SIMH pads odd-length records to an even length, E11 does not; both are accepted.
+package simhtape
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// markers and fields of the length words
+const (
+	tapeMark     = 0x00000000
+	endOfMedium  = 0xffffffff
+	eraseGap     = 0xfffffffe
+	halfGap      = 0xfffeffff
+	lengthMask   = 0x0fffffff
+	classShift   = 28
+	classGood    = 0x0
+	classBad     = 0x8 // the record could not be read correctly from the original tape
+	maxRecordLen = 0x00ffffff
+)
+
+// ErrBadImage is returned when the tape image does not have the expected framing
+var ErrBadImage = errors.New("not a valid SIMH/E11 tape image")
+
+// Reader returns the files on a tape image in turn
+type Reader struct {
+	br     *bufio.Reader
+	offset int64
+	number int
+	cur    *File
+	eot    bool
+}
+
+// File is a tape file, Read returns the data of its records concatenated.
+// The record counts are complete once Read has returned io.EOF.
+type File struct {
+	Number     int // from 1
+	Records    int
+	BadRecords int // records flagged as having had errors when the tape was read
+	Bytes      int64
+	t          *Reader
+	rec        []byte // unread data of the current record
+	done       bool
+}
+
+// NewReader returns a Reader for the tape image read from r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{br: bufio.NewReader(r)}
+}
+
+// Next returns the next file on the tape, skipping any unread part of the current file.
+// It returns io.EOF after the last file, which is followed by two tape marks or the end of the image.
+func (t *Reader) Next() (*File, error) {
+	if t.cur != nil && !t.cur.done {
+		if _, err := io.Copy(io.Discard, t.cur); err != nil {
+			return nil, err
+		}
+	}
+	if t.eot {
+		return nil, io.EOF
+	}
+	// an empty file, ie. a second tape mark, is the logical end of the tape
+	b, err := t.br.Peek(4)
+	if err == io.EOF || (err == nil && binary.LittleEndian.Uint32(b) == tapeMark) {
+		t.eot = true
+		return nil, io.EOF
+	}
+	t.number++
+	t.cur = &File{Number: t.number, t: t}
+	return t.cur, nil
+}
+
+func (t *Reader) readWord() (uint32, error) {
+	var b [4]byte
+	n, err := io.ReadFull(t.br, b[:])
+	t.offset += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+func (t *Reader) badImage(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrBadImage, fmt.Sprintf(format, a...), t.offset)
+}
+
+// nextRecord reads the next record of the file, returning io.EOF at the end of the file
+func (f *File) nextRecord() error {
+	t := f.t
+	for {
+		word, err := t.readWord()
+		if err == io.EOF {
+			// the image ended without a tape mark
+			t.eot = true
+			return io.EOF
+		}
+		if err != nil {
+			return t.badImage("incomplete record length")
+		}
+		switch word {
+		case tapeMark:
+			return io.EOF
+		case endOfMedium:
+			t.eot = true
+			return io.EOF
+		case eraseGap, halfGap:
+			continue
+		}
+		class := word >> classShift
+		length := int(word & lengthMask)
+		if (class != classGood && class != classBad) || length > maxRecordLen {
+			return t.badImage("unsupported record marker %#08x", word)
+		}
+		rec := make([]byte, length)
+		n, err := io.ReadFull(t.br, rec)
+		t.offset += int64(n)
+		if err != nil {
+			return t.badImage("truncated record of %d bytes", length)
+		}
+		if length%2 != 0 {
+			// SIMH adds a pad byte to odd-length records, E11 does not
+			b, err := t.br.Peek(5)
+			if err == nil && binary.LittleEndian.Uint32(b[:4]) != word && binary.LittleEndian.Uint32(b[1:]) == word {
+				t.br.Discard(1)
+				t.offset++
+			}
+		}
+		trailer, err := t.readWord()
+		if err != nil || trailer != word {
+			return t.badImage("record length %#08x not repeated after the record", word)
+		}
+		f.Records++
+		f.Bytes += int64(length)
+		if class == classBad {
+			f.BadRecords++
+		}
+		f.rec = rec
+		return nil
+	}
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	for len(f.rec) == 0 {
+		if f.done {
+			return 0, io.EOF
+		}
+		if err := f.nextRecord(); err != nil {
+			if err == io.EOF {
+				f.done = true
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, f.rec)
+	f.rec = f.rec[n:]
+	return n, nil
+}
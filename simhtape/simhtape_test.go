@@ -0,0 +1,80 @@
+package simhtape
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// image builds a tape image, "" being a tape mark
+func image(pad bool, records ...string) []byte {
+	var buf bytes.Buffer
+	word := func(w uint32) { binary.Write(&buf, binary.LittleEndian, w) }
+	for _, r := range records {
+		if r == "" {
+			word(tapeMark)
+			continue
+		}
+		length := uint32(len(r))
+		if r[0] == '!' { // a record with errors
+			length |= classBad << classShift
+		}
+		word(length)
+		buf.WriteString(r)
+		if pad && len(r)%2 != 0 {
+			buf.WriteByte(0)
+		}
+		word(length)
+	}
+	return buf.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	for _, pad := range []bool{true, false} {
+		tr := NewReader(bytes.NewReader(image(pad, "AB", "CDE", "", "!BAD", "", "")))
+		var contents []string
+		var files []File
+		for {
+			f, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatalf("pad %v: %v", pad, err)
+			}
+			contents = append(contents, string(data))
+			files = append(files, *f)
+		}
+		if len(contents) != 2 || contents[0] != "ABCDE" || contents[1] != "!BAD" {
+			t.Errorf("pad %v: unexpected tape files %q", pad, contents)
+			continue
+		}
+		if files[0].Records != 2 || files[0].Bytes != 5 || files[1].BadRecords != 1 {
+			t.Errorf("pad %v: unexpected counts %+v, %+v", pad, files[0], files[1])
+		}
+	}
+
+	// a file skipped without being read, and no final tape marks
+	tr := NewReader(bytes.NewReader(image(true, "SKIPPED", "", "LAST")))
+	tr.Next()
+	f, _ := tr.Next()
+	if data, _ := io.ReadAll(f); string(data) != "LAST" {
+		t.Errorf("Expected LAST, got %q", data)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF at the end of the tape, got %v", err)
+	}
+
+	bad := image(true, "DATA")
+	bad[len(bad)-1] = 1 // trailing length does not match
+	f, _ = NewReader(bytes.NewReader(bad)).Next()
+	if _, err := io.ReadAll(f); !errors.Is(err, ErrBadImage) {
+		t.Errorf("Expected ErrBadImage, got %v", err)
+	}
+}